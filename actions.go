@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/pkg/errors"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var (
+	// readOnly disables all actions that change the cluster
+	readOnly bool
+
+	// confirmDialog is the confirmation currently being asked, nil when
+	// there is nothing to confirm.
+	confirmDialog *ConfirmDialog
+
+	// statusString is the result of the last action, shown in the footer
+	statusString string
+)
+
+// ConfirmDialog asks the user to confirm an action before it is run.
+type ConfirmDialog struct {
+	message string
+	action  func() (string, error)
+}
+
+// confirmAction asks for confirmation before running an action against
+// the selected pod.
+func confirmAction(verb string, action func(k *KubeMetrics, pm PodMetrics) (string, error)) {
+	if readOnly {
+		statusString = "read-only mode, actions are disabled"
+		return
+	}
+	pm, ok := selectedPodMetrics()
+	if !ok {
+		statusString = "no container selected"
+		return
+	}
+	kube := kubeMetrics.Get(pm.Cluster)
+	if kube == nil {
+		return
+	}
+	dialog := &ConfirmDialog{
+		message: fmt.Sprintf("%s pod %s/%s?", verb, pm.Namespace, pm.Pod),
+		action: func() (string, error) {
+			return action(kube, pm)
+		},
+	}
+
+	updateLock.Lock()
+	confirmDialog = dialog
+	updateLock.Unlock()
+}
+
+func confirmDelete() {
+	confirmAction("Delete", func(k *KubeMetrics, pm PodMetrics) (string, error) {
+		return fmt.Sprintf("deleted pod %s/%s", pm.Namespace, pm.Pod), k.DeletePod(pm)
+	})
+}
+
+func confirmEvict() {
+	confirmAction("Evict", func(k *KubeMetrics, pm PodMetrics) (string, error) {
+		return fmt.Sprintf("evicted pod %s/%s", pm.Namespace, pm.Pod), k.EvictPod(pm)
+	})
+}
+
+func confirmRestart() {
+	confirmAction("Restart the owner of", func(k *KubeMetrics, pm PodMetrics) (string, error) {
+		owner, err := k.RestartOwner(pm)
+		return fmt.Sprintf("restarted %s", owner), err
+	})
+}
+
+// handleConfirmKey handles a key press while a confirmation is shown,
+// only 'y' runs the action, anything else cancels it.
+func handleConfirmKey(ev termbox.Event) {
+	updateLock.Lock()
+	dialog := confirmDialog
+	confirmDialog = nil
+	confirmed := ev.Ch == 'y' || ev.Ch == 'Y'
+	if confirmed {
+		statusString = "running..."
+	} else {
+		statusString = "cancelled"
+	}
+	updateLock.Unlock()
+
+	if !confirmed || dialog == nil {
+		return
+	}
+	go func() {
+		message, err := dialog.action()
+		if err != nil {
+			message = err.Error()
+		}
+		updateLock.Lock()
+		statusString = message
+		updateLock.Unlock()
+		requestRedraw()
+	}()
+}
+
+// drawConfirmDialog draws the confirmation in the middle of the screen.
+func drawConfirmDialog(dialog *ConfirmDialog) {
+	lines := []string{
+		"",
+		dialog.message,
+		"",
+		"(y) Yes / (n) No",
+		"",
+	}
+	width := 0
+	for _, line := range lines {
+		if len(line) > width {
+			width = len(line)
+		}
+	}
+	width += 4
+	x := (termWidth - width) / 2
+	y := (termHeight - len(lines)) / 2
+	for i, line := range lines {
+		padding := width - len(line)
+		line = strings.Repeat(" ", padding/2) + line + strings.Repeat(" ", padding-padding/2)
+		outputWord(line, x-leftPadding, y+i, highlightedColor)
+	}
+}
+
+// DeletePod deletes the pod.
+func (k *KubeMetrics) DeletePod(pm PodMetrics) error {
+	if err := k.kubeClient.CoreV1().Pods(pm.Namespace).Delete(pm.Pod, &metav1.DeleteOptions{}); err != nil {
+		return errors.Wrapf(err, "unable to delete pod %s/%s", pm.Namespace, pm.Pod)
+	}
+	return nil
+}
+
+// EvictPod evicts the pod using the eviction subresource, this will fail
+// if evicting the pod would violate a PodDisruptionBudget.
+func (k *KubeMetrics) EvictPod(pm PodMetrics) error {
+	eviction := &policyv1beta1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pm.Pod,
+			Namespace: pm.Namespace,
+		},
+	}
+	if err := k.kubeClient.CoreV1().Pods(pm.Namespace).Evict(eviction); err != nil {
+		return errors.Wrapf(err, "unable to evict pod %s/%s", pm.Namespace, pm.Pod)
+	}
+	return nil
+}
+
+// ResolveOwner returns the workload that owns a pod given the pod's
+// controller. Deployments own their pods through a ReplicaSet, so the
+// ReplicaSet's Deployment is returned instead.
+func (k *KubeMetrics) ResolveOwner(namespace, kind, name string) (*metav1.OwnerReference, error) {
+	owner := &metav1.OwnerReference{Kind: kind, Name: name}
+	if kind != "ReplicaSet" {
+		return owner, nil
+	}
+	rs, err := k.kubeClient.AppsV1().ReplicaSets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get replicaset %s/%s", namespace, name)
+	}
+	// A bare ReplicaSet is its own workload
+	if rsOwner := metav1.GetControllerOf(rs); rsOwner != nil && rsOwner.Kind == "Deployment" {
+		return rsOwner, nil
+	}
+	return owner, nil
+}
+
+// RestartOwner triggers a rollout restart of the Deployment, StatefulSet
+// or DaemonSet that owns the pod by patching an annotation on its pod
+// template, the same as `kubectl rollout restart`. The owner restarted
+// is returned.
+func (k *KubeMetrics) RestartOwner(pm PodMetrics) (string, error) {
+	pod, err := k.kubeClient.CoreV1().Pods(pm.Namespace).Get(pm.Pod, metav1.GetOptions{})
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get pod %s/%s", pm.Namespace, pm.Pod)
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil {
+		return "", errors.Errorf("pod %s/%s has no owner", pm.Namespace, pm.Pod)
+	}
+	owner, err = k.ResolveOwner(pm.Namespace, owner.Kind, owner.Name)
+	if err != nil {
+		return "", err
+	}
+	kind, name := owner.Kind, owner.Name
+
+	patch := []byte(fmt.Sprintf(
+		`{"spec":{"template":{"metadata":{"annotations":{"kubectl.kubernetes.io/restartedAt":%q}}}}}`,
+		time.Now().Format(time.RFC3339),
+	))
+	apps := k.kubeClient.AppsV1()
+	switch kind {
+	case "Deployment":
+		_, err = apps.Deployments(pm.Namespace).Patch(name, types.StrategicMergePatchType, patch)
+	case "StatefulSet":
+		_, err = apps.StatefulSets(pm.Namespace).Patch(name, types.StrategicMergePatchType, patch)
+	case "DaemonSet":
+		_, err = apps.DaemonSets(pm.Namespace).Patch(name, types.StrategicMergePatchType, patch)
+	default:
+		return "", errors.Errorf("unable to restart %s %s/%s", strings.ToLower(kind), pm.Namespace, name)
+	}
+	ownerName := fmt.Sprintf("%s %s/%s", strings.ToLower(kind), pm.Namespace, name)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to restart %s", ownerName)
+	}
+	return ownerName, nil
+}
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// alerts are the threshold alerts evaluated after every fetch
+	alerts = &Alerts{}
+
+	// alertsPaneHidden hides the alerts pane, it is shown by default
+	// when there are alert rules.
+	alertsPaneHidden bool
+
+	// alertRuleRegexp matches rules like "mem > 90% of limit for 30s"
+	// or "cpu > 2 cores".
+	alertRuleRegexp = regexp.MustCompile(`^(cpu|mem)\s*(>=|<=|>|<)\s*([0-9.]+)\s*(%|cores?|[a-zA-Z]+)?(?:\s+of\s+(limit|request))?(?:\s+for\s+(\S+))?$`)
+)
+
+// AlertConfig is an alert rule from the config file, Command is an
+// optional command run with `sh -c` when the alert fires.
+type AlertConfig struct {
+	Rule    string `json:"rule"`
+	Command string `json:"command"`
+}
+
+// AlertRule is a parsed alert rule.
+type AlertRule struct {
+	rule    string
+	command string
+
+	metric string
+	op     string
+	// threshold is either a percentage, millicores or bytes
+	threshold float64
+	// percentOf is "limit" or "request" for a percentage threshold
+	percentOf string
+	// duration is how long the threshold must be exceeded for
+	duration time.Duration
+}
+
+// ParseAlertRule parses a rule in the form:
+//
+//	<cpu|mem> <op> <value>[unit] [of <limit|request>] [for <duration>]
+//
+// ie: "mem > 90% of limit for 30s", "cpu > 2 cores" or "mem >= 1Gi".
+func ParseAlertRule(rule, command string) (*AlertRule, error) {
+	m := alertRuleRegexp.FindStringSubmatch(strings.TrimSpace(rule))
+	if m == nil {
+		return nil, errors.Errorf("unable to parse alert rule %q", rule)
+	}
+	r := &AlertRule{
+		rule:    rule,
+		command: command,
+		metric:  m[1],
+		op:      m[2],
+	}
+	value, unit, percentOf, duration := m[3], m[4], m[5], m[6]
+
+	switch {
+	case unit == "%":
+		threshold, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid percentage in alert rule %q", rule)
+		}
+		r.threshold = threshold
+		r.percentOf = percentOf
+		if r.percentOf == "" {
+			r.percentOf = "limit"
+		}
+	case percentOf != "":
+		return nil, errors.Errorf("only a percentage can be %q of %s in alert rule %q", value+unit, percentOf, rule)
+	case r.metric == "cpu" && (unit == "" || strings.HasPrefix(unit, "core")):
+		cores, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cores in alert rule %q", rule)
+		}
+		r.threshold = cores * 1000
+	default:
+		q, err := resource.ParseQuantity(value + unit)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid quantity in alert rule %q", rule)
+		}
+		if r.metric == "cpu" {
+			r.threshold = float64(q.MilliValue())
+		} else {
+			r.threshold = float64(q.Value())
+		}
+	}
+
+	if duration != "" {
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid duration in alert rule %q", rule)
+		}
+		r.duration = d
+	}
+	return r, nil
+}
+
+// value returns the value of the container to compare to the threshold,
+// false is returned if there is no limit or request to compare against.
+func (r *AlertRule) value(pm PodMetrics) (float64, bool) {
+	usage := pm.Usage.Cpu()
+	if r.metric == "mem" {
+		usage = pm.Usage.Memory()
+	}
+	if r.percentOf == "" {
+		if r.metric == "cpu" {
+			return float64(usage.MilliValue()), true
+		}
+		return float64(usage.Value()), true
+	}
+
+	resources := pm.ResourceLimits
+	if r.percentOf == "request" {
+		resources = pm.ResourceRequests
+	}
+	if r.metric == "cpu" {
+		return percentOf(usage, resources.Cpu())
+	}
+	return percentOf(usage, resources.Memory())
+}
+
+func (r *AlertRule) formatValue(v float64) string {
+	switch {
+	case r.percentOf != "":
+		return fmt.Sprintf("%.0f%% of %s", v, r.percentOf)
+	case r.metric == "cpu":
+		return formatMilliCPU(int64(v))
+	}
+	return formatMEM(int64(v))
+}
+
+// matches returns whether the container currently exceeds the threshold,
+// and the value compared.
+func (r *AlertRule) matches(pm PodMetrics) (bool, float64) {
+	v, ok := r.value(pm)
+	if !ok {
+		return false, 0
+	}
+	switch r.op {
+	case ">":
+		return v > r.threshold, v
+	case ">=":
+		return v >= r.threshold, v
+	case "<":
+		return v < r.threshold, v
+	case "<=":
+		return v <= r.threshold, v
+	}
+	return false, v
+}
+
+// Alert is a rule that a container has exceeded for the rule's duration.
+type Alert struct {
+	rule  *AlertRule
+	pm    PodMetrics
+	since time.Time
+	value float64
+}
+
+func (a *Alert) String() string {
+	return fmt.Sprintf("%s %s/%s/%s: %s (%s) for %s",
+		a.pm.Cluster, a.pm.Namespace, a.pm.Pod, a.pm.Container,
+		a.rule.rule, a.rule.formatValue(a.value),
+		formatAge(time.Since(a.since)),
+	)
+}
+
+type alertKey struct {
+	rule *AlertRule
+	id   string
+}
+
+// Alerts evaluates the alert rules against the metrics.
+type Alerts struct {
+	mu    sync.Mutex
+	rules []*AlertRule
+	// pending is when each container started exceeding a rule
+	pending map[alertKey]time.Time
+	active  map[alertKey]*Alert
+}
+
+func (a *Alerts) AddRule(rule *AlertRule) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rules = append(a.rules, rule)
+}
+
+// HasRules returns whether any alert rules are configured.
+func (a *Alerts) HasRules() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.rules) > 0
+}
+
+// Evaluate checks every rule against the metrics, any alerts that start
+// firing ring the terminal bell and run the rule's command.
+func (a *Alerts) Evaluate(metrics []PodMetrics, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	pending := map[alertKey]time.Time{}
+	active := map[alertKey]*Alert{}
+	fired := []*Alert{}
+	for _, rule := range a.rules {
+		for _, pm := range metrics {
+			ok, value := rule.matches(pm)
+			if !ok {
+				continue
+			}
+			key := alertKey{rule: rule, id: pm.UniqueID()}
+			since, ok := a.pending[key]
+			if !ok {
+				since = now
+			}
+			pending[key] = since
+			if now.Sub(since) < rule.duration {
+				continue
+			}
+			alert := &Alert{rule: rule, pm: pm, since: since, value: value}
+			active[key] = alert
+			if _, ok := a.active[key]; !ok {
+				fired = append(fired, alert)
+			}
+		}
+	}
+	a.pending = pending
+	a.active = active
+
+	if len(fired) > 0 {
+		// Ring the terminal bell
+		os.Stdout.WriteString("\a")
+	}
+	for _, alert := range fired {
+		if alert.rule.command != "" {
+			runAlertCommand(alert)
+		}
+	}
+}
+
+// IsActive returns whether the container has any alerts firing.
+func (a *Alerts) IsActive(id string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range a.active {
+		if key.id == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Active returns the alerts currently firing, longest firing first.
+func (a *Alerts) Active() []*Alert {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	active := make([]*Alert, 0, len(a.active))
+	for _, alert := range a.active {
+		active = append(active, alert)
+	}
+	sort.Slice(active, func(i, j int) bool {
+		if !active[i].since.Equal(active[j].since) {
+			return active[i].since.Before(active[j].since)
+		}
+		return active[i].String() < active[j].String()
+	})
+	return active
+}
+
+// runAlertCommand runs the alert's command in the background, with the
+// alert details available as environment variables.
+func runAlertCommand(alert *Alert) {
+	cmd := exec.Command("sh", "-c", alert.rule.command)
+	cmd.Env = append(os.Environ(),
+		"KTOP_ALERT_RULE="+alert.rule.rule,
+		"KTOP_ALERT_VALUE="+alert.rule.formatValue(alert.value),
+		"KTOP_CLUSTER="+alert.pm.Cluster,
+		"KTOP_NAMESPACE="+alert.pm.Namespace,
+		"KTOP_POD="+alert.pm.Pod,
+		"KTOP_CONTAINER="+alert.pm.Container,
+	)
+	if err := cmd.Start(); err != nil {
+		statusString = fmt.Sprintf("unable to run alert command: %s", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+func toggleAlertsPane() {
+	alertsPaneHidden = !alertsPaneHidden
+}
+
+// alertsPaneHeight is the number of lines the alerts pane needs, 0 if it
+// isn't shown.
+func alertsPaneHeight() int {
+	if alertsPaneHidden || !alerts.HasRules() {
+		return 0
+	}
+	// Show at most 5 alerts, plus the title
+	height := len(alerts.Active()) + 1
+	if height > 6 {
+		height = 6
+	}
+	return height
+}
+
+// drawAlertsPane draws the active alerts between top and bottom.
+func drawAlertsPane(top, bottom int) {
+	active := alerts.Active()
+	outputWord(fmt.Sprintf("alerts: %d firing", len(active)), 0, top, headerColor)
+	for i, alert := range active {
+		y := top + 1 + i
+		if y >= bottom {
+			break
+		}
+		outputWord(alert.String(), 0, y, warningColor)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	autoscalingv1 "k8s.io/api/autoscaling/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ownerMode groups the containers under the workload that owns them
+var ownerMode bool
+
+// ownersRefreshInterval is how often the ReplicaSets and autoscalers are
+// refetched, they don't need to be listed on every fetch.
+const ownersRefreshInterval = time.Minute
+
+// Autoscaler is the status of a HorizontalPodAutoscaler scaling a
+// workload.
+type Autoscaler struct {
+	Name            string
+	MinReplicas     int32
+	MaxReplicas     int32
+	CurrentReplicas int32
+	DesiredReplicas int32
+	// TargetCPU and CurrentCPU are the target and current average CPU
+	// utilisation as a percentage of the pods' requests, nil when unset.
+	TargetCPU  *int32
+	CurrentCPU *int32
+}
+
+func newAutoscaler(hpa autoscalingv1.HorizontalPodAutoscaler) *Autoscaler {
+	minReplicas := int32(1)
+	if hpa.Spec.MinReplicas != nil {
+		minReplicas = *hpa.Spec.MinReplicas
+	}
+	return &Autoscaler{
+		Name:            hpa.Name,
+		MinReplicas:     minReplicas,
+		MaxReplicas:     hpa.Spec.MaxReplicas,
+		CurrentReplicas: hpa.Status.CurrentReplicas,
+		DesiredReplicas: hpa.Status.DesiredReplicas,
+		TargetCPU:       hpa.Spec.TargetCPUUtilizationPercentage,
+		CurrentCPU:      hpa.Status.CurrentCPUUtilizationPercentage,
+	}
+}
+
+// AtMax returns whether the autoscaler wants to scale beyond its maximum
+// replicas, in which case the workload can't keep up with its load.
+func (a *Autoscaler) AtMax() bool {
+	return a.CurrentReplicas >= a.MaxReplicas && a.DesiredReplicas >= a.MaxReplicas
+}
+
+func (a *Autoscaler) utilisation() string {
+	percent := func(p *int32) string {
+		if p == nil {
+			return "-"
+		}
+		return fmt.Sprintf("%d%%", *p)
+	}
+	return percent(a.CurrentCPU) + "/" + percent(a.TargetCPU)
+}
+
+// Column is the short status shown in the HPA column, ie: 3/10 85%/80%.
+func (a *Autoscaler) Column() string {
+	column := fmt.Sprintf("%d/%d %s", a.CurrentReplicas, a.MaxReplicas, a.utilisation())
+	if a.AtMax() {
+		column += " MAX"
+	}
+	return column
+}
+
+// Summary is the full status of the autoscaler, shown in the owner
+// headings.
+func (a *Autoscaler) Summary() string {
+	summary := fmt.Sprintf(
+		"hpa %s | replicas %d current %d desired (min %d max %d) | cpu %s current/target",
+		a.Name, a.CurrentReplicas, a.DesiredReplicas, a.MinReplicas, a.MaxReplicas, a.utilisation(),
+	)
+	if a.AtMax() {
+		summary += " | at max replicas"
+	}
+	return summary
+}
+
+// workloadKey identifies a workload in a namespace, ie: default/Deployment/web.
+func workloadKey(namespace, kind, name string) string {
+	return namespace + "/" + kind + "/" + name
+}
+
+// fetchOwners returns the workloads and autoscalers, refetching them if
+// they are older than ownersRefreshInterval.
+func (k *KubeMetrics) fetchOwners() (map[string]metav1.OwnerReference, map[string]*Autoscaler) {
+	if k.workloads == nil || time.Since(k.ownersFetched) >= ownersRefreshInterval {
+		k.workloads = k.fetchWorkloads()
+		k.autoscalers = k.fetchAutoscalers()
+		k.ownersFetched = time.Now()
+	}
+	return k.workloads, k.autoscalers
+}
+
+// fetchWorkloads returns the owning workloads of the ReplicaSets, keyed
+// by workloadKey, so pods can be matched to their Deployment. Listing
+// ReplicaSets may not be allowed, so errors are ignored.
+func (k *KubeMetrics) fetchWorkloads() map[string]metav1.OwnerReference {
+	workloads := map[string]metav1.OwnerReference{}
+	replicaSets, err := k.kubeClient.AppsV1().ReplicaSets(k.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return workloads
+	}
+	for _, rs := range replicaSets.Items {
+		if owner := metav1.GetControllerOf(&rs); owner != nil && owner.Kind == "Deployment" {
+			workloads[workloadKey(rs.Namespace, "ReplicaSet", rs.Name)] = *owner
+		}
+	}
+	return workloads
+}
+
+// fetchAutoscalers returns the autoscalers keyed by the workloadKey of
+// the workload they scale. Listing autoscalers may not be allowed, so
+// errors are ignored.
+func (k *KubeMetrics) fetchAutoscalers() map[string]*Autoscaler {
+	autoscalers := map[string]*Autoscaler{}
+	hpas, err := k.kubeClient.AutoscalingV1().HorizontalPodAutoscalers(k.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return autoscalers
+	}
+	for _, hpa := range hpas.Items {
+		target := hpa.Spec.ScaleTargetRef
+		autoscalers[workloadKey(hpa.Namespace, target.Kind, target.Name)] = newAutoscaler(hpa)
+	}
+	return autoscalers
+}
+
+// groupByOwner groups the rows under a heading for each workload, with
+// the status of the workload's autoscaler if it has one. The first
+// pinned rows are kept at the top.
+func groupByOwner(rows []PodMetrics, pinned int) []tableLine {
+	return groupRows(rows, pinned,
+		func(pm PodMetrics) string {
+			return pm.Cluster + "/" + workloadKey(pm.Namespace, pm.WorkloadKind, pm.WorkloadName)
+		},
+		func(pm PodMetrics) tableLine {
+			heading := fmt.Sprintf("%s %s/%s", pm.WorkloadKind, pm.Namespace, pm.WorkloadName)
+			if pm.WorkloadKind == "" {
+				heading = "pods without an owner in " + pm.Namespace
+			}
+			if len(kubeMetrics) > 1 {
+				heading = pm.Cluster + " " + heading
+			}
+			line := tableLine{index: -1, heading: heading}
+			if a := pm.Autoscaler; a != nil {
+				line.heading += " | " + a.Summary()
+				line.warning = a.AtMax()
+			}
+			return line
+		},
+	)
+}
+
+func toggleOwnerMode() {
+	ownerMode = !ownerMode
+	nodeMode = false
+}
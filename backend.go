@@ -0,0 +1,136 @@
+package main
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset_generated/clientset"
+)
+
+const (
+	backendMetricsServer = "metrics-server"
+	backendPrometheus    = "prometheus"
+
+	metricsGroup = "metrics.k8s.io"
+)
+
+// errNoMetricsAPI is returned when the cluster doesn't serve any version
+// of the metrics API that we support.
+var errNoMetricsAPI = errors.New("the metrics API (metrics.k8s.io) is not registered, is metrics-server installed?")
+
+// BackendConfig configures where the container usage is fetched from.
+type BackendConfig struct {
+	// Name is the backend to use, either "metrics-server", "prometheus"
+	// or "kubelet"
+	Name string
+
+	PrometheusURL      string
+	PrometheusCPUQuery string
+	PrometheusMEMQuery string
+	// PrometheusThrottleQuery must return the fraction of CFS periods
+	// each container was throttled in
+	PrometheusThrottleQuery string
+}
+
+// ContainerUsage is the usage of a single container from a backend.
+type ContainerUsage struct {
+	Namespace string
+	Pod       string
+	Container string
+	// Timestamp is when the usage was measured
+	Timestamp time.Time
+	Usage     corev1.ResourceList
+	// Stats are only available from the kubelet backend
+	Stats *ContainerStats
+	// Throttled is the percentage of CFS periods the container was
+	// throttled in, only available from the prometheus backend
+	Throttled *float64
+}
+
+// MetricsBackend fetches the current usage of every container.
+type MetricsBackend interface {
+	// FetchUsage fetches the usage for the containers in namespace, an
+	// empty namespace is all namespaces.
+	FetchUsage(namespace string) ([]ContainerUsage, error)
+}
+
+// metricsServerBackend fetches the usage from the metrics API, served by
+// metrics-server. The API version is negotiated on the first fetch as
+// older clusters and custom adapters may only serve v1alpha1.
+type metricsServerBackend struct {
+	metricsClient *metricsclientset.Clientset
+	version       string
+}
+
+// negotiateVersion uses discovery to pick the newest metrics API version
+// served by the cluster.
+func (m *metricsServerBackend) negotiateVersion() error {
+	groups, err := m.metricsClient.Discovery().ServerGroups()
+	if err != nil {
+		return errors.Wrapf(err, "unable to discover api groups")
+	}
+	for _, group := range groups.Groups {
+		if group.Name != metricsGroup {
+			continue
+		}
+		served := map[string]bool{}
+		for _, v := range group.Versions {
+			served[v.Version] = true
+		}
+		for _, version := range []string{"v1beta1", "v1alpha1"} {
+			if served[version] {
+				m.version = version
+				return nil
+			}
+		}
+		return errors.Errorf("the metrics API (metrics.k8s.io) doesn't serve a supported version, only v1beta1 and v1alpha1 are supported")
+	}
+	return errNoMetricsAPI
+}
+
+func (m *metricsServerBackend) FetchUsage(namespace string) ([]ContainerUsage, error) {
+	if m.version == "" {
+		if err := m.negotiateVersion(); err != nil {
+			return nil, err
+		}
+	}
+
+	usage := []ContainerUsage{}
+	switch m.version {
+	case "v1alpha1":
+		metrics, err := m.metricsClient.MetricsV1alpha1().PodMetricses(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get pod metrics")
+		}
+		for _, pod := range metrics.Items {
+			for _, c := range pod.Containers {
+				usage = append(usage, ContainerUsage{
+					Namespace: pod.Namespace,
+					Pod:       pod.Name,
+					Container: c.Name,
+					Timestamp: pod.Timestamp.Time,
+					Usage:     c.Usage,
+				})
+			}
+		}
+	default:
+		metrics, err := m.metricsClient.MetricsV1beta1().PodMetricses(namespace).List(metav1.ListOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get pod metrics")
+		}
+		for _, pod := range metrics.Items {
+			for _, c := range pod.Containers {
+				usage = append(usage, ContainerUsage{
+					Namespace: pod.Namespace,
+					Pod:       pod.Name,
+					Container: c.Name,
+					Timestamp: pod.Timestamp.Time,
+					Usage:     c.Usage,
+				})
+			}
+		}
+	}
+	return usage, nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Clusters is a set of KubeMetrics, one per kubeconfig context, that
+// are fetched concurrently and displayed as a single merged view.
+type Clusters []*KubeMetrics
+
+// FetchMetrics fetches the metrics for every cluster concurrently. An
+// error is only returned if every cluster failed; individual cluster
+// errors are available from each KubeMetrics.
+func (c Clusters) FetchMetrics() error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(c))
+	for i, k := range c {
+		wg.Add(1)
+		go func(i int, k *KubeMetrics) {
+			defer wg.Done()
+			errs[i] = k.FetchMetrics()
+		}(i, k)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err == nil {
+			return nil
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Wrap(errs[0], "unable to fetch metrics from any cluster")
+}
+
+// Get returns the KubeMetrics for a kubeconfig context, or nil if we
+// aren't connected to that context.
+func (c Clusters) Get(context string) *KubeMetrics {
+	for _, k := range c {
+		if k.context == context {
+			return k
+		}
+	}
+	return nil
+}
+
+// GetMetrics returns the merged metrics from all clusters.
+func (c Clusters) GetMetrics() []PodMetrics {
+	metrics := []PodMetrics{}
+	for _, k := range c {
+		metrics = append(metrics, k.GetMetrics()...)
+	}
+	return metrics
+}
+
+// LastFetched returns the most recent successful fetch time across
+// all clusters.
+func (c Clusters) LastFetched() time.Time {
+	var lastFetched time.Time
+	for _, k := range c {
+		if t := k.LastFetched(); t.After(lastFetched) {
+			lastFetched = t
+		}
+	}
+	return lastFetched
+}
+
+// HeaderString returns a summary of the clusters we are connected to.
+// A single cluster shows its full details, multiple clusters show the
+// status of each context.
+func (c Clusters) HeaderString() string {
+	if len(c) == 1 {
+		header := c[0].HeaderString()
+		if c[0].Err() != nil {
+			header += " | unreachable"
+		}
+		return header
+	}
+
+	statuses := make([]string, 0, len(c))
+	for _, k := range c {
+		status := "ok"
+		if k.Err() != nil {
+			status = "unreachable"
+		}
+		statuses = append(statuses, fmt.Sprintf("%s=%s", k.context, status))
+	}
+	return "clusters: " + strings.Join(statuses, " ")
+}
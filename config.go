@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// Config is the user configuration loaded from the config file.
+type Config struct {
+	// Keys maps a key name, ie: "q", "ctrl-c", "space", to a command
+	// name, ie: "quit". A command of "none" unbinds the key.
+	Keys map[string]string `json:"keys"`
+
+	// Theme is the name of the colour theme to use.
+	Theme string `json:"theme"`
+
+	// Colors is the number of colours to use, either 8 or 256. If not
+	// set it is guessed from $TERM.
+	Colors int `json:"colors"`
+
+	// Sidecars are the names of containers treated as sidecars, they
+	// replace the default sidecars.
+	Sidecars []string `json:"sidecars"`
+
+	// Alerts are the threshold alert rules to evaluate.
+	Alerts []AlertConfig `json:"alerts"`
+}
+
+// defaultConfigPath returns ~/.ktop.json, or an empty string if the home
+// directory can't be determined.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ktop.json")
+}
+
+// loadConfig reads the config file at path. A missing file is not an
+// error and results in an empty config.
+func loadConfig(path string) (Config, error) {
+	config := Config{}
+	if path == "" {
+		return config, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return config, errors.Wrapf(err, "unable to read config %q", path)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, errors.Wrapf(err, "unable to parse config %q", path)
+	}
+	return config, nil
+}
@@ -2,12 +2,11 @@ package main
 
 import (
 	"fmt"
-	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	termbox "github.com/nsf/termbox-go"
-	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 const (
@@ -22,13 +21,27 @@ var (
 	filterString       string
 	mouseX             int
 	mouseY             int
-	orderOption        OrderOption
 	podMetrics         []PodMetrics
 	selectedID         string
 	selectedIndex      int = -1
 	infoString         string
 	updateLock         sync.Mutex
 	previousPodMetrics = map[string]PodMetrics{}
+	pinnedIDs          = map[string]bool{}
+	tableLines         []tableLine
+	// drawnLines is how many of the tableLines fit on the screen the last
+	// time the table was drawn.
+	drawnLines int
+	// statsAvailable is set when the backend provides ContainerStats,
+	// showStats toggles displaying them.
+	statsAvailable bool
+	showStats      = true
+	showDetails    = true
+	hideSidecars   bool
+	// podMode shows a row per pod rather than per container, drillDownPod
+	// is the PodID of the pod whose containers are being shown.
+	podMode      bool
+	drillDownPod string
 )
 
 type TermColor struct {
@@ -36,25 +49,52 @@ type TermColor struct {
 	fg termbox.Attribute
 }
 
+// Colours used to draw the screen, set from the theme by applyTheme.
 var (
-	normalColor         = TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite}
-	headingColor        = TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite | termbox.AttrBold}
-	highlightedColor    = TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack}
-	changeIncreaseColor = TermColor{bg: termbox.ColorGreen, fg: termbox.ColorWhite | termbox.AttrBold}
-	changeDecreaseColor = TermColor{bg: termbox.ColorRed, fg: termbox.ColorWhite | termbox.AttrBold}
-	headerColor         = TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack}
-	footerColor         = TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack}
+	normalColor         TermColor
+	headingColor        TermColor
+	highlightedColor    TermColor
+	changeIncreaseColor TermColor
+	changeDecreaseColor TermColor
+	warningColor        TermColor
+	headerColor         TermColor
+	footerColor         TermColor
 )
 
 type DisplayHeader struct {
-	name           string
-	getColumn      func(p PodMetrics) string
+	name      string
+	getColumn func(p PodMetrics) string
+	// compare returns -1, 0 or 1 if pi is less than, equal to or greater
+	// than pj. If not set the column values are compared as strings.
+	compare func(pi, pj PodMetrics) int
+	// snapshotOnly columns are only displayed when a snapshot is taken
+	snapshotOnly bool
+	// statsOnly columns are only displayed when the backend provides
+	// ContainerStats and they are toggled on
+	statsOnly bool
+	// throttlingOnly columns are only displayed when the backend
+	// provides the actual CFS throttling
+	throttlingOnly bool
+	// detailsOnly columns are wide descriptive columns that can be
+	// toggled off to make room for the usage columns
+	detailsOnly    bool
 	maxLength      int
 	forceMaxLength int
 }
 
 func (dh *DisplayHeader) GetName() string {
-	return dh.getPossibleName(dh.name)
+	name := dh.getPossibleName(dh.name)
+	if dh == primarySort.header {
+		name += sortArrow(primarySort.desc)
+	}
+	return name
+}
+
+func (dh *DisplayHeader) Compare(pi, pj PodMetrics) int {
+	if dh.compare != nil {
+		return dh.compare(pi, pj)
+	}
+	return strings.Compare(dh.getColumn(pi), dh.getColumn(pj))
 }
 
 func (dh *DisplayHeader) getPossibleName(name string) string {
@@ -69,10 +109,15 @@ func (dh *DisplayHeader) GetLength() int {
 		// TODO(vishen): WHY DO I NEED THIS?!!!!!
 		return dh.forceMaxLength + 3
 	}
-	if dh.maxLength < minRowSize {
+	// Leave room for the sort arrow after the name
+	length := dh.maxLength
+	if l := len(dh.name) + 2; l > length {
+		length = l
+	}
+	if length < minRowSize {
 		return minRowSize
 	}
-	return dh.maxLength
+	return length
 }
 
 func (dh *DisplayHeader) GetFrom(p PodMetrics) string {
@@ -87,104 +132,396 @@ func (dh *DisplayHeader) Record(p PodMetrics) {
 }
 
 var (
+	// clusterHeader is only displayed when viewing multiple clusters
+	clusterHeader = &DisplayHeader{name: "CLUSTER", getColumn: func(p PodMetrics) string { return p.Cluster }}
+
+	cpuHeader = &DisplayHeader{
+		name:      "CPU",
+		getColumn: func(p PodMetrics) string { return p.CPU },
+		compare:   func(pi, pj PodMetrics) int { return pi.Usage.Cpu().Cmp(*pj.Usage.Cpu()) },
+	}
+	memHeader = &DisplayHeader{
+		name:      "MEM",
+		getColumn: func(p PodMetrics) string { return p.MEM },
+		compare:   func(pi, pj PodMetrics) int { return pi.Usage.Memory().Cmp(*pj.Usage.Memory()) },
+	}
+
 	displayHeaders = []*DisplayHeader{
 		{name: "NAMESPACE", getColumn: func(p PodMetrics) string { return p.Namespace }},
 		{name: "POD", getColumn: func(p PodMetrics) string { return p.Pod }},
-		{name: "CONTAINER", getColumn: func(p PodMetrics) string { return p.Container }},
-		{name: "CPU", getColumn: func(p PodMetrics) string { return p.CPU }},
-		{name: "MEM", getColumn: func(p PodMetrics) string { return p.MEM }},
+		{name: "CONTAINER", getColumn: func(p PodMetrics) string {
+			if p.ContainerCount > 0 {
+				return fmt.Sprintf("%d containers", p.ContainerCount)
+			}
+			return p.Container
+		}},
+		cpuHeader,
+		memHeader,
+		{
+			name:         "CPU DELTA",
+			snapshotOnly: true,
+			getColumn: func(p PodMetrics) string {
+				if d, ok := cpuDelta(p); ok {
+					return fmt.Sprintf("%+dm", d)
+				}
+				return ""
+			},
+			compare: func(pi, pj PodMetrics) int {
+				di, _ := cpuDelta(pi)
+				dj, _ := cpuDelta(pj)
+				return compareInt64(di, dj)
+			},
+		},
+		{
+			name:         "MEM DELTA",
+			snapshotOnly: true,
+			getColumn: func(p PodMetrics) string {
+				if d, ok := memDelta(p); ok {
+					return fmt.Sprintf("%+dMi", d)
+				}
+				return ""
+			},
+			compare: func(pi, pj PodMetrics) int {
+				di, _ := memDelta(pi)
+				dj, _ := memDelta(pj)
+				return compareInt64(di, dj)
+			},
+		},
+		{
+			name:      "CPU%LIM",
+			getColumn: func(p PodMetrics) string { return formatPercent(p.CPUPercentOfLimit()) },
+			compare: func(pi, pj PodMetrics) int {
+				return comparePercent(pi.CPUPercentOfLimit, pj.CPUPercentOfLimit)
+			},
+		},
+		{
+			name:      "MEM%LIM",
+			getColumn: func(p PodMetrics) string { return formatPercent(p.MEMPercentOfLimit()) },
+			compare: func(pi, pj PodMetrics) int {
+				return comparePercent(pi.MEMPercentOfLimit, pj.MEMPercentOfLimit)
+			},
+		},
+		{
+			name:      "RESTARTS",
+			getColumn: func(p PodMetrics) string { return fmt.Sprintf("%d", p.Restarts) },
+			compare:   func(pi, pj PodMetrics) int { return compareInt64(int64(pi.Restarts), int64(pj.Restarts)) },
+		},
+		{
+			name:      "STATUS",
+			getColumn: func(p PodMetrics) string { return p.Status },
+			compare: func(pi, pj PodMetrics) int {
+				if c := compareInt64(int64(statusSeverity(pi.Status)), int64(statusSeverity(pj.Status))); c != 0 {
+					return c
+				}
+				return strings.Compare(pi.Status, pj.Status)
+			},
+		},
+		{
+			name:      "THROTTLE RISK",
+			getColumn: formatThrottleRisk,
+			compare: func(pi, pj PodMetrics) int {
+				return comparePercent(optionalPercent(pi.ThrottleRisk), optionalPercent(pj.ThrottleRisk))
+			},
+		},
+		{
+			name:           "THROTTLED",
+			throttlingOnly: true,
+			getColumn: func(p PodMetrics) string {
+				if p.Throttled == nil {
+					return "-"
+				}
+				return fmt.Sprintf("%.0f%%", *p.Throttled)
+			},
+			compare: func(pi, pj PodMetrics) int {
+				return comparePercent(optionalPercent(pi.Throttled), optionalPercent(pj.Throttled))
+			},
+		},
+		{
+			name:      "LEAK",
+			getColumn: func(p PodMetrics) string { return formatLeakScore(p.Leak) },
+			compare:   compareLeakScore,
+		},
+		{
+			name:      "MEM ETA",
+			getColumn: func(p PodMetrics) string { return formatLeakETA(p.Leak) },
+			compare:   compareLeakETA,
+		},
+		{
+			name:      "AGE",
+			getColumn: func(p PodMetrics) string { return formatSince(p.Created) },
+			compare:   func(pi, pj PodMetrics) int { return compareSince(pi.Created, pj.Created) },
+		},
+		{
+			name:      "UPTIME",
+			getColumn: func(p PodMetrics) string { return formatSince(p.StartedAt) },
+			compare:   func(pi, pj PodMetrics) int { return compareSince(pi.StartedAt, pj.StartedAt) },
+		},
+		{name: "TYPE", detailsOnly: true, getColumn: func(p PodMetrics) string { return p.ContainerType }},
+		{name: "NODE", detailsOnly: true, getColumn: func(p PodMetrics) string { return p.Node }},
+		{
+			name:        "HPA",
+			detailsOnly: true,
+			getColumn: func(p PodMetrics) string {
+				if p.Autoscaler == nil {
+					return ""
+				}
+				return p.Autoscaler.Column()
+			},
+		},
+		{
+			name:        "QOS",
+			detailsOnly: true,
+			getColumn:   func(p PodMetrics) string { return p.QOSClass },
+			compare: func(pi, pj PodMetrics) int {
+				return compareInt64(int64(qosRank(pi.QOSClass)), int64(qosRank(pj.QOSClass)))
+			},
+		},
+		{
+			name:        "PRIORITY",
+			detailsOnly: true,
+			getColumn:   formatPriority,
+			compare:     func(pi, pj PodMetrics) int { return compareInt64(int64(pi.Priority), int64(pj.Priority)) },
+		},
+		statsHeader("RSS", func(s *ContainerStats) uint64 { return s.MEMRSSBytes }),
+		statsHeader("WSS", func(s *ContainerStats) uint64 { return s.MEMWorkingSetBytes }),
+		statsHeader("ROOTFS", func(s *ContainerStats) uint64 { return s.RootfsUsedBytes }),
+		statsHeader("LOGS", func(s *ContainerStats) uint64 { return s.LogsUsedBytes }),
+		statsHeader("EPHEMERAL", func(s *ContainerStats) uint64 { return s.PodEphemeralStorageUsedBytes }),
+		statsHeader("NET RX", func(s *ContainerStats) uint64 { return s.PodNetworkRxBytes }),
+		statsHeader("NET TX", func(s *ContainerStats) uint64 { return s.PodNetworkTxBytes }),
 	}
 )
 
-type OrderOption int
+// statsHeader creates a column for a value from ContainerStats
+func statsHeader(name string, value func(s *ContainerStats) uint64) *DisplayHeader {
+	get := func(p PodMetrics) uint64 {
+		if p.Stats == nil {
+			return 0
+		}
+		return value(p.Stats)
+	}
+	return &DisplayHeader{
+		name:      name,
+		statsOnly: true,
+		getColumn: func(p PodMetrics) string {
+			if p.Stats == nil {
+				return "-"
+			}
+			return formatBytes(get(p))
+		},
+		compare: func(pi, pj PodMetrics) int {
+			return compareInt64(int64(get(pi)), int64(get(pj)))
+		},
+	}
+}
 
-const (
-	OrderNotSet OrderOption = iota
-	OrderCPUAsc
-	OrderCPUDec
-	OrderMEMAsc
-	OrderMEMDec
-)
+// formatSince formats the time since t like kubectl, or "-" if t is zero.
+func formatSince(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return formatAge(time.Since(t))
+}
 
-func setOrderOption(sortOrderOption OrderOption) {
-	orderOption = sortOrderOption
+// formatAge formats a duration like kubectl, ie: 5s, 3m, 2h, 4d.
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
 }
 
-func sortMetricsByOrder(podMetrics []PodMetrics) {
-	order := 1
-	fromUsage := func(pm PodMetrics) *resource.Quantity {
-		return pm.Usage.Cpu()
+// formatBytes formats bytes using the largest binary unit, ie: 1.5Gi.
+func formatBytes(bytes uint64) string {
+	units := []string{"", "Ki", "Mi", "Gi", "Ti"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
 	}
+	if unit == 0 {
+		return fmt.Sprintf("%d", bytes)
+	}
+	return fmt.Sprintf("%.1f%s", value, units[unit])
+}
 
-	switch orderOption {
-	case OrderCPUDec:
-		// Sort options are defaulted to this
-	case OrderCPUAsc:
-		order = -1
-	case OrderMEMDec:
-		fromUsage = func(pm PodMetrics) *resource.Quantity {
-			return pm.Usage.Memory()
+// visibleHeaders returns the headers that should currently be displayed
+func visibleHeaders() []*DisplayHeader {
+	headers := make([]*DisplayHeader, 0, len(displayHeaders))
+	for _, header := range displayHeaders {
+		if header.snapshotOnly && len(previousPodMetrics) == 0 {
+			continue
 		}
-	case OrderMEMAsc:
-		order = -1
-		fromUsage = func(pm PodMetrics) *resource.Quantity {
-			return pm.Usage.Memory()
+		if header.statsOnly && !(statsAvailable && showStats) {
+			continue
 		}
-	default:
-		sort.Slice(podMetrics, func(i, j int) bool {
-			pi := podMetrics[i]
-			pj := podMetrics[j]
-			if pi.Pod == pj.Pod {
-				return pi.Container < pj.Container
-			}
-			return pi.Pod < pj.Pod
-		})
-		return
+		if header.throttlingOnly && !throttlingAvailable {
+			continue
+		}
+		if header.detailsOnly && !showDetails {
+			continue
+		}
+		headers = append(headers, header)
 	}
+	return headers
+}
 
-	sort.Slice(podMetrics, func(i, j int) bool {
-		pi := podMetrics[i]
-		pj := podMetrics[j]
-		result := fromUsage(pi).Cmp(*fromUsage(pj))
-		if result == 0 {
-			if pi.Pod == pj.Pod {
-				return pi.Container < pj.Container
-			}
-			return pi.Pod < pj.Pod
+// headerAt returns the header displayed at x, or nil if there isn't one.
+func headerAt(x int) *DisplayHeader {
+	currentX := 0
+	for _, header := range visibleHeaders() {
+		if x >= getX(currentX) && x < getX(currentX+header.GetLength()) {
+			return header
 		}
-		return result == order
-	})
+		currentX += header.GetLength() + 1
+	}
+	return nil
+}
+
+// formatPercent formats a percentage returned by PodMetrics, or "-" if
+// there is no percentage.
+func formatPercent(percent float64, ok bool) string {
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.0f%%", percent)
 }
 
 func setMouseClick(x, y int, key termbox.Key) {
 	// TODO: Remove this lock
 	updateLock.Lock()
 	defer updateLock.Unlock()
+	// The table is covered by the full screen views and the dialog
+	if logView != nil || overcommitView || quotaView != nil || confirmDialog != nil {
+		return
+	}
 	switch key {
 	case termbox.MouseLeft:
-		if len(podMetrics) >= y-2 && y > 1 {
-			selectedIndex = y - 2
+		if y == 1 {
+			if header := headerAt(x); header != nil {
+				toggleSort(header)
+			}
+		} else if y > 1 && y-2 < drawnLines && tableLines[y-2].index >= 0 {
+			selectedIndex = tableLines[y-2].index
 			selectedID = podMetrics[selectedIndex].UniqueID()
+			togglePinned(selectedID)
 		}
 	case termbox.MouseRight:
 		selectedID = ""
 	}
 }
 
+// togglePinned pins or unpins a row, pinned rows are always displayed at
+// the top regardless of the sort order or filter.
+func togglePinned(id string) {
+	if pinnedIDs[id] {
+		delete(pinnedIDs, id)
+	} else {
+		pinnedIDs[id] = true
+	}
+}
+
+func toggleSelectedPinned() {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	if selectedID != "" {
+		togglePinned(selectedID)
+	}
+}
+
+func unpinAll() {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	pinnedIDs = map[string]bool{}
+}
+
 func updateSelectedID(i int) {
 	// TODO: Remove this lock
 	updateLock.Lock()
 	defer updateLock.Unlock()
 
-	selectedIndex += i
-	if selectedIndex < 0 {
-		selectedIndex = 0
-	} else if selectedIndex >= len(podMetrics) {
-		selectedIndex = len(podMetrics) - 1
+	// Rows are moved through in the order they are drawn, which differs
+	// from podMetrics when they are grouped under headings.
+	rows := []int{}
+	current := -1
+	for _, line := range tableLines {
+		if line.index < 0 || line.index >= len(podMetrics) {
+			continue
+		}
+		if line.index == selectedIndex {
+			current = len(rows)
+		}
+		rows = append(rows, line.index)
+	}
+	if len(rows) == 0 {
+		return
+	}
+
+	next := current + i
+	if current < 0 {
+		next = 0
 	}
+	if next < 0 {
+		next = 0
+	} else if next >= len(rows) {
+		next = len(rows) - 1
+	}
+	selectedIndex = rows[next]
 	selectedID = podMetrics[selectedIndex].UniqueID()
 }
 
+// togglePodMode switches between a row per container and a row per pod
+func togglePodMode() {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	podMode = !podMode
+	drillDownPod = ""
+}
+
+// drillDown shows the containers of the selected pod when in pod mode,
+// or goes back to the pods if we are already showing a pod's containers.
+func drillDown() {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	if !podMode {
+		return
+	}
+	if drillDownPod != "" {
+		drillDownPod = ""
+		return
+	}
+	if pm, ok := selectedPodMetricsLocked(); ok {
+		drillDownPod = pm.PodID()
+	}
+}
+
+// selectedPodMetrics returns the currently selected row, if any.
+func selectedPodMetrics() (PodMetrics, bool) {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	return selectedPodMetricsLocked()
+}
+
+func selectedPodMetricsLocked() (PodMetrics, bool) {
+	for _, pm := range podMetrics {
+		if pm.UniqueID() == selectedID {
+			return pm, true
+		}
+	}
+	return PodMetrics{}, false
+}
+
 func snapshot() {
 	// If we are toggling disable snapshot
 	if len(previousPodMetrics) > 0 {
@@ -201,25 +538,65 @@ func updateScreen() {
 	// TODO: Remove this lock
 	updateLock.Lock()
 	defer updateLock.Unlock()
-	termbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+	termbox.Clear(normalColor.fg, normalColor.bg)
 
-	headerString := fmt.Sprintf("filter: %s", filterString)
-	outputWord(headerString, 0, 0, headerColor)
+	if logView != nil {
+		drawLogView(logView)
+		termbox.Flush()
+		return
+	}
+	if overcommitView {
+		drawOvercommitReport()
+		termbox.Flush()
+		return
+	}
+	if quotaView != nil {
+		drawQuotaView()
+		termbox.Flush()
+		return
+	}
 
 	// TODO: Cache these values, otherwise we get noticable lag when typing
 	// as there is lock competition; this should ideally happen in the background.
 	// This shouldn't use a lock if possible.
 	allPodMetrics := kubeMetrics.GetMetrics()
+	allContainers := len(allPodMetrics)
+	if podMode && drillDownPod == "" {
+		allPodMetrics = aggregatePods(allPodMetrics)
+	}
 
 	podMetrics = make([]PodMetrics, 0, len(allPodMetrics))
+	pinnedMetrics := []PodMetrics{}
+	allPods := map[string]bool{}
+	shownPods := map[string]bool{}
+	shownContainers := 0
 	for _, pr := range allPodMetrics {
-		// Filter out any pods based on the filter string
+		podID := pr.PodID()
+		allPods[podID] = true
+
+		if drillDownPod != "" && podID != drillDownPod {
+			continue
+		}
+
+		// Filter out any pods based on the filter string, pinned
+		// pods are never filtered
 		valid := false
-		if filterString != "" {
+		if pinnedIDs[pr.UniqueID()] {
+			valid = true
+		} else if hideSidecars && pr.ContainerType == ContainerTypeSidecar {
+			valid = false
+		} else if qosFilter != "" && pr.QOSClass != qosFilter {
+			valid = false
+		} else if priorityFilter != "" && pr.PriorityClass != priorityFilter {
+			valid = false
+		} else if filterString != "" {
 			names := []string{
+				pr.Cluster,
 				pr.Namespace,
 				pr.Pod,
 				pr.Container,
+				pr.QOSClass,
+				pr.PriorityClass,
 			}
 			for _, n := range names {
 				if strings.Contains(n, filterString) {
@@ -234,29 +611,80 @@ func updateScreen() {
 			continue
 		}
 
-		podMetrics = append(podMetrics, pr)
+		if pinnedIDs[pr.UniqueID()] {
+			pinnedMetrics = append(pinnedMetrics, pr)
+		} else {
+			podMetrics = append(podMetrics, pr)
+		}
+		shownPods[podID] = true
+		if pr.ContainerCount > 0 {
+			shownContainers += pr.ContainerCount
+		} else {
+			shownContainers++
+		}
 
 		// Record the longest string so we can display column lengths
 		// correctly
-		for _, header := range displayHeaders {
+		for _, header := range visibleHeaders() {
 			header.Record(pr)
 		}
 	}
 
-	// sort metrics
-	sortMetricsByOrder(podMetrics)
+	// sort metrics, with the pinned metrics always at the top
+	sortMetrics(pinnedMetrics)
+	sortMetrics(podMetrics)
+	podMetrics = append(pinnedMetrics, podMetrics...)
+
+	if nodeMode {
+		tableLines = groupByNode(podMetrics, len(pinnedMetrics))
+	} else if ownerMode {
+		tableLines = groupByOwner(podMetrics, len(pinnedMetrics))
+	} else {
+		tableLines = make([]tableLine, len(podMetrics))
+		for i := range podMetrics {
+			tableLines[i] = tableLine{index: i}
+		}
+	}
+
+	lastFetched := "never"
+	if t := kubeMetrics.LastFetched(); !t.IsZero() {
+		lastFetched = t.Format("15:04:05")
+	}
+	headerString := fmt.Sprintf(
+		"%s | pods: %d/%d | containers: %d/%d | updated: %s | filter: %s",
+		kubeMetrics.HeaderString(),
+		len(shownPods), len(allPods),
+		shownContainers, allContainers,
+		lastFetched,
+		filterString,
+	)
+	if drillDownPod != "" {
+		headerString += " | pod: " + drillDownPod
+	}
+	if qosFilter != "" {
+		headerString += " | qos: " + qosFilter
+	}
+	if priorityFilter != "" {
+		headerString += " | priority: " + priorityFilter
+	}
+	if filterMode {
+		headerString += "_"
+	}
+	outputWord(headerString, 0, 0, headerColor)
+
+	headers := visibleHeaders()
 
 	// Total column width
 	totalHeaderWidth := 0
-	for _, header := range displayHeaders {
+	for _, header := range headers {
 		// Add a single space between each header, can't think of
 		// a better place to put this.
 		totalHeaderWidth += header.GetLength() + 1
 	}
 
 	/*if totalHeaderWidth > termWidth {
-		possibleHeaderWidth := termWidth / len(displayHeaders)
-		for _, header := range displayHeaders {
+		possibleHeaderWidth := termWidth / len(headers)
+		for _, header := range headers {
 			if header.GetLength() > possibleHeaderWidth {
 				header.forceMaxLength = possibleHeaderWidth
 			}
@@ -266,19 +694,17 @@ func updateScreen() {
 	{
 		// Display headers
 		currentX := 0
-		for _, header := range displayHeaders {
+		for _, header := range headers {
 			// TODO(vishen): FIX THIS HACK!
 			// TODO(vishen): FIX THIS HACK!
 			// TODO(vishen): FIX THIS HACK!
 			// TODO(vishen): FIX THIS HACK!
 			// TODO(vishen): FIX THIS HACK!
 			if totalHeaderWidth > termWidth {
-				if header.name == "POD" {
+				if header.name == "POD" || header.name == "NODE" {
 					header.forceMaxLength = 25
 				} else if header.name == "CONTAINER" {
 					header.forceMaxLength = 20
-				} else if header.name == "CPU" || header.name == "MEM" {
-					header.forceMaxLength = 5
 				}
 			}
 			outputWord(header.GetName(), currentX, 1, headingColor)
@@ -288,14 +714,33 @@ func updateScreen() {
 		}
 	}
 
-	for y, pr := range podMetrics {
+	// The table fills the screen down to the info line, the alerts and
+	// events panes are stacked above the info line when they are open.
+	alertsTop := termHeight - 3 - alertsPaneHeight()
+	tableBottom := alertsTop
+	if eventsPane != nil && termHeight/2 < tableBottom {
+		tableBottom = termHeight / 2
+	}
+
+	drawnLines = 0
+	for y, line := range tableLines {
 		// Don't let the data go over the footer
-		if y > termHeight-3 {
+		if y+2 >= tableBottom {
 			break
 		}
+		drawnLines = y + 1
+		if line.index < 0 {
+			color := headingColor
+			if line.warning {
+				color = warningColor
+			}
+			outputWord(line.heading, 0, y+2, color)
+			continue
+		}
+		pr := podMetrics[line.index]
 
 		currentX := 0
-		for _, header := range displayHeaders {
+		for _, header := range headers {
 			color := normalColor
 			value := header.GetFrom(pr)
 			// TODO(vishen): super hacky, but will work for now
@@ -327,29 +772,98 @@ func updateScreen() {
 					}
 				}
 			}
+			if alerts.IsActive(pr.UniqueID()) || isBestEffortHog(pr) || pr.Leak.Leaking() {
+				color = warningColor
+			}
 			if pr.UniqueID() == selectedID {
 				color = highlightedColor
-				selectedIndex = y
+				selectedIndex = line.index
 				infoString = pr.InfoString()
+				if r, ok := recommend(history.Samples(pr.UniqueID())); ok {
+					infoString += " -- " + r.String()
+				}
 			}
 			outputWord(value, currentX, y+2, color)
 			currentX += header.GetLength() + 1
 		}
+		if pinnedIDs[pr.UniqueID()] {
+			// Mark pinned rows in the left padding
+			termbox.SetCell(0, getY(y+2), '*', normalColor.fg, normalColor.bg)
+		}
+	}
+
+	if eventsPane != nil {
+		if pm, ok := selectedPodMetricsLocked(); ok {
+			eventsPane.setPod(pm)
+		}
+		eventsPane.draw(tableBottom, alertsTop)
+	}
+	if alertsTop < termHeight-3 {
+		drawAlertsPane(alertsTop, termHeight-3)
 	}
 
 	outputWord(infoString, 0, termHeight-3, footerColor)
 
 	// Draw footer with options
-	footerString := "Sort by (1) CPU Dec / (2) CPU Asc / (3) Mem Dec / (4) Mem Asc | (SPACE) Snapshot | (ESC) Quit"
+	footerString := footerHelp()
+	if filterMode {
+		footerString = "Filtering: (ENTER) Apply | (ESC) Clear"
+	}
 	if len(previousPodMetrics) > 0 {
 		footerString += " -- Snapshot taken!"
 	}
+	if statusString != "" {
+		footerString += " -- " + statusString
+	}
 	outputWord(footerString, 0, termHeight-2, footerColor)
 
+	if confirmDialog != nil {
+		drawConfirmDialog(confirmDialog)
+	}
+
 	termbox.Flush()
 
 }
 
+// footerHelp builds the footer from the current key bindings
+func footerHelp() string {
+	help := func(cmd Command, name string) string {
+		key := keyHelp(cmd)
+		if key == "" {
+			return ""
+		}
+		return fmt.Sprintf("(%s) %s", key, name)
+	}
+	join := func(sep string, options ...string) string {
+		set := []string{}
+		for _, o := range options {
+			if o != "" {
+				set = append(set, o)
+			}
+		}
+		return strings.Join(set, sep)
+	}
+
+	sortHelp := join(" / ",
+		help(CommandSortCPUDec, "CPU Dec"),
+		help(CommandSortCPUAsc, "CPU Asc"),
+		help(CommandSortMEMDec, "Mem Dec"),
+		help(CommandSortMEMAsc, "Mem Asc"),
+	)
+	if sortHelp != "" {
+		sortHelp = "Sort by " + sortHelp
+	}
+	return join(" | ",
+		sortHelp,
+		help(CommandFilter, "Filter"),
+		help(CommandPin, "Pin"),
+		help(CommandSnapshot, "Snapshot"),
+		help(CommandLogs, "Logs"),
+		help(CommandEvents, "Events"),
+		help(CommandQuit, "Quit"),
+	)
+}
+
 func getX(x int) int {
 	return x + leftPadding
 }
@@ -361,7 +875,9 @@ func getY(y int) int {
 func outputWord(word string, startingX, y int, color TermColor) {
 	startingX = getX(startingX)
 	y = getY(y)
-	for x, c := range word {
-		termbox.SetCell(startingX+x, y, c, color.fg, color.bg)
+	x := startingX
+	for _, c := range word {
+		termbox.SetCell(x, y, c, color.fg, color.bg)
+		x++
 	}
 }
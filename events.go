@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// eventsPane is the events pane currently open, nil when closed
+var eventsPane *EventsPane
+
+// EventsPane shows the events for the selected pod and its node below
+// the metrics table.
+type EventsPane struct {
+	mu     sync.Mutex
+	pm     PodMetrics
+	events []corev1.Event
+	err    error
+}
+
+func toggleEventsPane() {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	if eventsPane != nil {
+		eventsPane = nil
+		return
+	}
+	eventsPane = &EventsPane{}
+}
+
+// refreshEvents refetches the events for the open events pane, if any.
+func refreshEvents() {
+	updateLock.Lock()
+	pane := eventsPane
+	updateLock.Unlock()
+
+	if pane != nil {
+		pane.refresh()
+	}
+}
+
+// setPod changes the pod the events are shown for, fetching the events
+// in the background if the pod has changed.
+func (e *EventsPane) setPod(pm PodMetrics) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.pm.UniqueID() == pm.UniqueID() {
+		return
+	}
+	e.pm = pm
+	e.events = nil
+	e.err = nil
+	go func() {
+		e.refresh()
+		requestRedraw()
+	}()
+}
+
+func (e *EventsPane) refresh() {
+	e.mu.Lock()
+	pm := e.pm
+	e.mu.Unlock()
+
+	kube := kubeMetrics.Get(pm.Cluster)
+	if pm.Pod == "" || kube == nil {
+		return
+	}
+	events, err := kube.FetchEvents(pm)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	// The selected pod changed while we were fetching
+	if e.pm.UniqueID() != pm.UniqueID() {
+		return
+	}
+	e.err = err
+	if err == nil {
+		sort.Slice(events, func(i, j int) bool {
+			return eventTime(events[i]).After(eventTime(events[j]))
+		})
+		e.events = events
+	}
+}
+
+func eventTime(ev corev1.Event) time.Time {
+	if !ev.LastTimestamp.IsZero() {
+		return ev.LastTimestamp.Time
+	}
+	return ev.FirstTimestamp.Time
+}
+
+// draw draws the events pane between top and bottom, most recent events
+// first.
+func (e *EventsPane) draw(top, bottom int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	title := "events: no container selected"
+	if e.pm.Pod != "" {
+		title = fmt.Sprintf("events: pod %s/%s, node %s", e.pm.Namespace, e.pm.Pod, e.pm.Node)
+	}
+	outputWord(title, 0, top, headerColor)
+
+	y := top + 1
+	if e.err != nil {
+		outputWord(fmt.Sprintf("unable to get events: %s", e.err), 0, y, warningColor)
+		y++
+	}
+	for _, ev := range e.events {
+		if y >= bottom {
+			break
+		}
+		color := normalColor
+		if ev.Type == corev1.EventTypeWarning {
+			color = warningColor
+		}
+		line := fmt.Sprintf("%-5s %-8s %-20s %-5s x%-4d %s",
+			formatAge(time.Since(eventTime(ev))),
+			ev.Type,
+			ev.Reason,
+			strings.ToLower(ev.InvolvedObject.Kind),
+			ev.Count,
+			strings.Replace(ev.Message, "\n", " ", -1),
+		)
+		outputWord(line, 0, y, color)
+		y++
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// containerMetric is a metric exposed for each container
+type containerMetric struct {
+	name       string
+	help       string
+	metricType string
+	value      func(p PodMetrics) (float64, bool)
+}
+
+var (
+	containerMetrics = []containerMetric{
+		{
+			name:       "ktop_container_cpu_usage_cores",
+			help:       "CPU usage of the container in cores.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				return float64(p.Usage.Cpu().MilliValue()) / 1000, true
+			},
+		},
+		{
+			name:       "ktop_container_memory_usage_bytes",
+			help:       "Memory usage of the container in bytes.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				return float64(p.Usage.Memory().Value()), true
+			},
+		},
+		{
+			name:       "ktop_container_cpu_request_cores",
+			help:       "CPU request of the container in cores.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				q := p.ResourceRequests.Cpu()
+				return float64(q.MilliValue()) / 1000, !q.IsZero()
+			},
+		},
+		{
+			name:       "ktop_container_cpu_limit_cores",
+			help:       "CPU limit of the container in cores.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				q := p.ResourceLimits.Cpu()
+				return float64(q.MilliValue()) / 1000, !q.IsZero()
+			},
+		},
+		{
+			name:       "ktop_container_memory_request_bytes",
+			help:       "Memory request of the container in bytes.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				q := p.ResourceRequests.Memory()
+				return float64(q.Value()), !q.IsZero()
+			},
+		},
+		{
+			name:       "ktop_container_memory_limit_bytes",
+			help:       "Memory limit of the container in bytes.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				q := p.ResourceLimits.Memory()
+				return float64(q.Value()), !q.IsZero()
+			},
+		},
+		{
+			name:       "ktop_container_cpu_limit_ratio",
+			help:       "CPU usage of the container as a ratio of its CPU limit.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				percent, ok := p.CPUPercentOfLimit()
+				return percent / 100, ok
+			},
+		},
+		{
+			name:       "ktop_container_memory_limit_ratio",
+			help:       "Memory usage of the container as a ratio of its memory limit.",
+			metricType: "gauge",
+			value: func(p PodMetrics) (float64, bool) {
+				percent, ok := p.MEMPercentOfLimit()
+				return percent / 100, ok
+			},
+		},
+		{
+			name:       "ktop_container_restarts_total",
+			help:       "Number of times the container has restarted.",
+			metricType: "counter",
+			value: func(p PodMetrics) (float64, bool) {
+				return float64(p.Restarts), true
+			},
+		},
+	}
+
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+// startExporter serves the current metrics in the Prometheus text format
+// on addr at /metrics.
+func startExporter(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrapf(err, "unable to listen on %s", addr)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", serveMetrics)
+	go http.Serve(listener, mux)
+	return nil
+}
+
+func serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(formatMetrics(kubeMetrics.GetMetrics()))
+}
+
+// formatMetrics formats the metrics in the Prometheus text format.
+func formatMetrics(metrics []PodMetrics) []byte {
+	var buf bytes.Buffer
+	for _, cm := range containerMetrics {
+		fmt.Fprintf(&buf, "# HELP %s %s\n", cm.name, cm.help)
+		fmt.Fprintf(&buf, "# TYPE %s %s\n", cm.name, cm.metricType)
+		for _, p := range metrics {
+			value, ok := cm.value(p)
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&buf, "%s{%s} %g\n", cm.name, formatLabels(p), value)
+		}
+	}
+	return buf.Bytes()
+}
+
+func formatLabels(p PodMetrics) string {
+	labels := []struct{ name, value string }{
+		{"cluster", p.Cluster},
+		{"namespace", p.Namespace},
+		{"pod", p.Pod},
+		{"container", p.Container},
+		{"node", p.Node},
+	}
+	formatted := make([]string, len(labels))
+	for i, l := range labels {
+		formatted[i] = fmt.Sprintf(`%s="%s"`, l.name, labelEscaper.Replace(l.value))
+	}
+	return strings.Join(formatted, ",")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// history is the per container usage history for all clusters
+var history = NewHistory(time.Hour)
+
+// Sample is a single usage measurement of a container.
+type Sample struct {
+	Time time.Time
+	// CPU is in millicores
+	CPU int64
+	// MEM is in bytes
+	MEM int64
+}
+
+// History keeps the usage samples of each container over a window of
+// time, keyed by PodMetrics.UniqueID.
+type History struct {
+	mu      sync.Mutex
+	window  time.Duration
+	samples map[string][]Sample
+}
+
+func NewHistory(window time.Duration) *History {
+	return &History{
+		window:  window,
+		samples: map[string][]Sample{},
+	}
+}
+
+// SetWindow changes how long samples are kept for.
+func (h *History) SetWindow(window time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.window = window
+}
+
+// Record adds a sample of the container's current usage taken at t. The
+// metrics API only updates periodically, so a sample with the same time
+// as the previous sample is ignored.
+func (h *History) Record(pm PodMetrics, t time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	id := pm.UniqueID()
+	samples := h.samples[id]
+	if len(samples) > 0 && !t.After(samples[len(samples)-1].Time) {
+		return
+	}
+	h.samples[id] = append(samples, Sample{
+		Time: t,
+		CPU:  pm.Usage.Cpu().MilliValue(),
+		MEM:  pm.Usage.Memory().Value(),
+	})
+}
+
+// Prune removes samples older than the window, and any containers with
+// no samples left.
+func (h *History) Prune(now time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cutoff := now.Add(-h.window)
+	for id, samples := range h.samples {
+		i := 0
+		for i < len(samples) && samples[i].Time.Before(cutoff) {
+			i++
+		}
+		if i == len(samples) {
+			delete(h.samples, id)
+			continue
+		}
+		h.samples[id] = samples[i:]
+	}
+}
+
+// Samples returns a copy of the samples for a container, oldest first.
+func (h *History) Samples(id string) []Sample {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	samples := make([]Sample, len(h.samples[id]))
+	copy(samples, h.samples[id])
+	return samples
+}
+
+// formatMilliCPU formats millicores the same as a resource.Quantity.
+func formatMilliCPU(milli int64) string {
+	return resource.NewMilliQuantity(milli, resource.DecimalSI).String()
+}
+
+// formatMEM formats bytes in Mi, rounding up.
+func formatMEM(bytes int64) string {
+	mi := (bytes + (1 << 20) - 1) >> 20
+	return resource.NewQuantity(mi<<20, resource.BinarySI).String()
+}
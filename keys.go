@@ -0,0 +1,272 @@
+package main
+
+import (
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/pkg/errors"
+)
+
+type Command string
+
+const (
+	CommandNone       Command = "none"
+	CommandQuit       Command = "quit"
+	CommandFilter     Command = "filter"
+	CommandSnapshot   Command = "snapshot"
+	CommandPin        Command = "pin"
+	CommandUnpinAll   Command = "unpin-all"
+	CommandLogs       Command = "logs"
+	CommandEvents     Command = "events"
+	CommandDelete     Command = "delete"
+	CommandEvict      Command = "evict"
+	CommandRestart    Command = "restart"
+	CommandExport     Command = "export-recommendations"
+	CommandAlerts     Command = "alerts"
+	CommandStats      Command = "stats"
+	CommandDetails    Command = "details"
+	CommandSidecars   Command = "sidecars"
+	CommandPodMode    Command = "pods"
+	CommandDrillDown  Command = "drill-down"
+	CommandNodeMode   Command = "nodes"
+	CommandOvercommit Command = "overcommit"
+	CommandQOS        Command = "qos-filter"
+	CommandPriority   Command = "priority-filter"
+	CommandQuotas     Command = "quotas"
+	CommandOwners     Command = "owners"
+	CommandUp         Command = "up"
+	CommandDown       Command = "down"
+	CommandSortCPUDec Command = "sort-cpu-desc"
+	CommandSortCPUAsc Command = "sort-cpu-asc"
+	CommandSortMEMDec Command = "sort-mem-desc"
+	CommandSortMEMAsc Command = "sort-mem-asc"
+	CommandSortPrev   Command = "sort-prev"
+	CommandSortNext   Command = "sort-next"
+	CommandSortRev    Command = "sort-reverse"
+)
+
+var (
+	// commands are the actions that can be bound to a key. Quit is
+	// handled by the event loop and so isn't listed here.
+	commands = map[Command]func(){
+		CommandFilter:     startFilter,
+		CommandSnapshot:   snapshot,
+		CommandPin:        toggleSelectedPinned,
+		CommandUnpinAll:   unpinAll,
+		CommandLogs:       openLogView,
+		CommandEvents:     toggleEventsPane,
+		CommandDelete:     confirmDelete,
+		CommandEvict:      confirmEvict,
+		CommandRestart:    confirmRestart,
+		CommandExport:     exportRecommendations,
+		CommandAlerts:     toggleAlertsPane,
+		CommandStats:      func() { showStats = !showStats },
+		CommandDetails:    func() { showDetails = !showDetails },
+		CommandSidecars:   func() { hideSidecars = !hideSidecars },
+		CommandPodMode:    togglePodMode,
+		CommandDrillDown:  drillDown,
+		CommandNodeMode:   toggleNodeMode,
+		CommandOvercommit: toggleOvercommitView,
+		CommandQOS:        cycleQOSFilter,
+		CommandPriority:   cyclePriorityFilter,
+		CommandQuotas:     toggleQuotaView,
+		CommandOwners:     toggleOwnerMode,
+		CommandUp:         func() { updateSelectedID(-1) },
+		CommandDown:       func() { updateSelectedID(1) },
+		CommandSortCPUDec: func() { setSort(cpuHeader, true) },
+		CommandSortCPUAsc: func() { setSort(cpuHeader, false) },
+		CommandSortMEMDec: func() { setSort(memHeader, true) },
+		CommandSortMEMAsc: func() { setSort(memHeader, false) },
+		CommandSortPrev:   func() { moveSort(-1) },
+		CommandSortNext:   func() { moveSort(1) },
+		CommandSortRev:    reverseSort,
+	}
+
+	keyMap = map[string]Command{
+		"esc":    CommandQuit,
+		"q":      CommandQuit,
+		"ctrl-c": CommandQuit,
+		"/":      CommandFilter,
+		"space":  CommandPin,
+		"u":      CommandUnpinAll,
+		"s":      CommandSnapshot,
+		"l":      CommandLogs,
+		"e":      CommandEvents,
+		"D":      CommandDelete,
+		"E":      CommandEvict,
+		"R":      CommandRestart,
+		"x":      CommandExport,
+		"a":      CommandAlerts,
+		"t":      CommandStats,
+		"c":      CommandDetails,
+		"i":      CommandSidecars,
+		"p":      CommandPodMode,
+		"enter":  CommandDrillDown,
+		"n":      CommandNodeMode,
+		"o":      CommandOvercommit,
+		"Q":      CommandQOS,
+		"P":      CommandPriority,
+		"N":      CommandQuotas,
+		"w":      CommandOwners,
+		"up":     CommandUp,
+		"down":   CommandDown,
+		"1":      CommandSortCPUDec,
+		"2":      CommandSortCPUAsc,
+		"3":      CommandSortMEMDec,
+		"4":      CommandSortMEMAsc,
+		"<":      CommandSortPrev,
+		">":      CommandSortNext,
+		"r":      CommandSortRev,
+	}
+
+	keyNames = map[termbox.Key]string{
+		termbox.KeyEsc:        "esc",
+		termbox.KeyCtrlC:      "ctrl-c",
+		termbox.KeySpace:      "space",
+		termbox.KeyEnter:      "enter",
+		termbox.KeyTab:        "tab",
+		termbox.KeyBackspace:  "backspace",
+		termbox.KeyBackspace2: "backspace",
+		termbox.KeyDelete:     "delete",
+		termbox.KeyInsert:     "insert",
+		termbox.KeyHome:       "home",
+		termbox.KeyEnd:        "end",
+		termbox.KeyPgup:       "pgup",
+		termbox.KeyPgdn:       "pgdn",
+		termbox.KeyArrowUp:    "up",
+		termbox.KeyArrowDown:  "down",
+		termbox.KeyArrowLeft:  "left",
+		termbox.KeyArrowRight: "right",
+		termbox.KeyF1:         "f1",
+		termbox.KeyF2:         "f2",
+		termbox.KeyF3:         "f3",
+		termbox.KeyF4:         "f4",
+		termbox.KeyF5:         "f5",
+		termbox.KeyF6:         "f6",
+		termbox.KeyF7:         "f7",
+		termbox.KeyF8:         "f8",
+		termbox.KeyF9:         "f9",
+		termbox.KeyF10:        "f10",
+		termbox.KeyF11:        "f11",
+		termbox.KeyF12:        "f12",
+	}
+
+	// filterMode is set while the user is typing a filter string
+	filterMode bool
+)
+
+// applyKeyBindings overrides the default key bindings with those from
+// the user config.
+func applyKeyBindings(bindings map[string]string) error {
+	for key, name := range bindings {
+		cmd := Command(name)
+		if _, ok := commands[cmd]; !ok && cmd != CommandQuit && cmd != CommandNone {
+			return errors.Errorf("unknown command %q bound to key %q", name, key)
+		}
+		if cmd == CommandNone {
+			delete(keyMap, key)
+			continue
+		}
+		keyMap[key] = cmd
+	}
+	return nil
+}
+
+// keyName returns the name of the key pressed, used to lookup the
+// command in the keyMap.
+func keyName(ev termbox.Event) string {
+	if ev.Ch != 0 {
+		return string(ev.Ch)
+	}
+	return keyNames[ev.Key]
+}
+
+// keyHelp returns the key bound to a command for displaying in the
+// footer, or an empty string if the command isn't bound.
+func keyHelp(cmd Command) string {
+	// Prefer the shortest key name so "q" is shown rather than "ctrl-c",
+	// and sort ties so the footer doesn't change between runs.
+	keys := []string{}
+	for key, c := range keyMap {
+		if c == cmd {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	shortest := keys[0]
+	for _, key := range keys[1:] {
+		if len(key) < len(shortest) || (len(key) == len(shortest) && key < shortest) {
+			shortest = key
+		}
+	}
+	// Keys are case sensitive, so only named keys like "space" are
+	// upper cased.
+	if len([]rune(shortest)) > 1 {
+		return strings.ToUpper(shortest)
+	}
+	return shortest
+}
+
+func startFilter() {
+	filterMode = true
+}
+
+// handleFilterKey handles a key press while in filter mode. ENTER
+// keeps the filter, ESC clears it, both return to normal mode.
+func handleFilterKey(ev termbox.Event) {
+	switch ev.Key {
+	case termbox.KeyEnter:
+		filterMode = false
+	case termbox.KeyEsc:
+		filterMode = false
+		filterString = ""
+	case termbox.KeyBackspace, termbox.KeyBackspace2:
+		if len(filterString) > 0 {
+			filterString = filterString[:len(filterString)-1]
+		}
+	default:
+		if ch := ev.Ch; ch > ' ' && ch <= '~' {
+			filterString += string(ch)
+		}
+	}
+}
+
+// handleKey runs the command bound to the key pressed, returning false
+// if the application should quit.
+func handleKey(ev termbox.Event) bool {
+	// Ctrl-C always quits, even when filtering
+	if ev.Key == termbox.KeyCtrlC {
+		return false
+	}
+	if confirmDialog != nil {
+		handleConfirmKey(ev)
+		return true
+	}
+	if logView != nil {
+		handleLogKey(ev)
+		return true
+	}
+	if overcommitView {
+		handleOvercommitKey(ev)
+		return true
+	}
+	if quotaView != nil {
+		handleQuotaKey(ev)
+		return true
+	}
+	if filterMode {
+		handleFilterKey(ev)
+		return true
+	}
+	cmd, ok := keyMap[keyName(ev)]
+	if !ok {
+		return true
+	}
+	if cmd == CommandQuit {
+		return false
+	}
+	commands[cmd]()
+	return true
+}
@@ -3,50 +3,217 @@ package main
 import (
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
 	metricsclientset "k8s.io/metrics/pkg/client/clientset_generated/clientset"
 )
 
+const (
+	ContainerTypeApp     = "app"
+	ContainerTypeInit    = "init"
+	ContainerTypeSidecar = "sidecar"
+
+	// requestTimeout is the longest a single request to a cluster can
+	// take, so an unreachable cluster is reported rather than waited on.
+	requestTimeout = 10 * time.Second
+)
+
+// sidecarNames are the names of app containers that are treated as
+// sidecars, ie: service mesh proxies.
+var sidecarNames = map[string]bool{
+	"istio-proxy":   true,
+	"linkerd-proxy": true,
+}
+
 type PodMetrics struct {
-	Namespace        string
-	Pod              string
-	Container        string
-	Node             string
+	Cluster       string
+	Namespace     string
+	Pod           string
+	Container     string
+	ContainerType string
+	Node          string
+	OwnerKind     string
+	OwnerName     string
+	// WorkloadKind and WorkloadName are the workload that owns the pod,
+	// which is the Deployment rather than the ReplicaSet for Deployments.
+	WorkloadKind string
+	WorkloadName string
+	// Autoscaler is set when the workload is scaled by an HPA
+	Autoscaler *Autoscaler
+	// Created is when the pod was created and StartedAt is when the
+	// container last started, zero when it isn't running.
+	Created       time.Time
+	StartedAt     time.Time
+	Restarts      int32
+	Status        string
+	QOSClass      string
+	PriorityClass string
+	Priority      int32
+	// ContainerCount is set when the metrics are for a whole pod, see
+	// aggregatePods.
+	ContainerCount   int
 	CPU              string
 	MEM              string
 	Usage            corev1.ResourceList
 	ResourceRequests corev1.ResourceList
 	ResourceLimits   corev1.ResourceList
+	// PodEffectiveRequests are the requests used to schedule the pod, see
+	// effectiveRequests.
+	PodEffectiveRequests corev1.ResourceList
+	// Stats are only set by backends that provide them
+	Stats *ContainerStats
+	// Leak is the memory trend over the history window, nil until there
+	// are enough samples
+	Leak *Leak
+	// ThrottleRisk is the average CPU usage over the history window as a
+	// percentage of the CPU limit, nil without a CPU limit
+	ThrottleRisk *float64
+	// Throttled is the percentage of CFS periods the container was
+	// throttled in, only set by backends that provide it
+	Throttled *float64
 }
 
 func (p PodMetrics) UniqueID() string {
-	return fmt.Sprintf("%s.%s.%s", p.Namespace, p.Pod, p.Container)
+	return fmt.Sprintf("%s.%s.%s.%s", p.Cluster, p.Namespace, p.Pod, p.Container)
+}
+
+// PodID uniquely identifies the pod the container is in.
+func (p PodMetrics) PodID() string {
+	return fmt.Sprintf("%s.%s.%s", p.Cluster, p.Namespace, p.Pod)
 }
 
 func (p PodMetrics) InfoString() string {
-	return fmt.Sprintf("requests: %s -- limits: %s", p.formatResource(p.ResourceRequests), p.formatResource(p.ResourceLimits))
+	info := fmt.Sprintf(
+		"requests: %s -- limits: %s -- pod effective requests: %s",
+		p.formatResource(p.ResourceRequests),
+		p.formatResource(p.ResourceLimits),
+		p.formatResource(p.PodEffectiveRequests),
+	)
+	if p.Autoscaler != nil {
+		info += " -- " + p.Autoscaler.Summary()
+	}
+	return info
+}
+
+// CPUPercentOfLimit returns the CPU usage as a percentage of the CPU
+// limit, false is returned if there is no CPU limit.
+func (p PodMetrics) CPUPercentOfLimit() (float64, bool) {
+	return percentOf(p.Usage.Cpu(), p.ResourceLimits.Cpu())
+}
+
+// MEMPercentOfLimit returns the memory usage as a percentage of the
+// memory limit, false is returned if there is no memory limit.
+func (p PodMetrics) MEMPercentOfLimit() (float64, bool) {
+	return percentOf(p.Usage.Memory(), p.ResourceLimits.Memory())
+}
+
+func percentOf(usage, limit *resource.Quantity) (float64, bool) {
+	if limit.IsZero() {
+		return 0, false
+	}
+	return float64(usage.MilliValue()) / float64(limit.MilliValue()) * 100, true
 }
 
 func (p PodMetrics) formatResource(rl corev1.ResourceList) string {
-	return fmt.Sprintf("cpu=%s mem=%dMi", rl.Cpu().String(), rl.Memory().ScaledValue(resource.Mega))
+	return fmt.Sprintf("cpu=%s mem=%s", rl.Cpu().String(), formatMEM(rl.Memory().Value()))
 
 }
 
 type KubeMetrics struct {
+	context       string
+	cluster       string
+	serverVersion string
 	namespace     string
-	metricsClient *metricsclientset.Clientset
+	backend       MetricsBackend
 	kubeClient    *kubernetes.Clientset
 
-	mu      sync.Mutex
-	metrics []PodMetrics
+	// mu guards the results of the last fetch, it is only held while
+	// they are read or swapped so that a slow cluster doesn't block the
+	// screen from being drawn.
+	mu          sync.Mutex
+	metrics     []PodMetrics
+	lastFetched time.Time
+	fetchErr    error
+	nodes       map[string]*NodeInfo
 
-	fetchedResources bool
-	resources        map[string]PodMetrics
+	// The workloads and autoscalers change rarely, so they are only
+	// refetched every ownersRefreshInterval. They are only used by the
+	// fetch.
+	workloads     map[string]metav1.OwnerReference
+	autoscalers   map[string]*Autoscaler
+	ownersFetched time.Time
+}
+
+// NewKubeMetrics creates the kubernetes and metrics clients for the
+// given kubeconfig context. An empty context uses the current context.
+func NewKubeMetrics(kubeConfig, kubeContext string, backendConfig BackendConfig) (*KubeMetrics, error) {
+	// Create the kubernetes client configuration
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{
+			ExplicitPath: kubeConfig,
+		},
+		&clientcmd.ConfigOverrides{
+			CurrentContext: kubeContext,
+		},
+	)
+	clientConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create k8s client config")
+	}
+	// An unreachable cluster shouldn't hold up the other clusters
+	clientConfig.Timeout = requestTimeout
+
+	// Determine the context and cluster names to show in the heading
+	rawConfig, err := loader.RawConfig()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load k8s config")
+	}
+	if kubeContext == "" {
+		kubeContext = rawConfig.CurrentContext
+	}
+	kubeCluster := ""
+	if c, ok := rawConfig.Contexts[kubeContext]; ok {
+		kubeCluster = c.Cluster
+	}
+
+	kubeClient, err := kubernetes.NewForConfig(clientConfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to create k8s client")
+	}
+
+	var backend MetricsBackend
+	switch backendConfig.Name {
+	case backendMetricsServer, "":
+		metricsClient, err := metricsclientset.NewForConfig(clientConfig)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to create metrics client")
+		}
+		backend = &metricsServerBackend{metricsClient: metricsClient}
+	case backendPrometheus:
+		backend, err = newPrometheusBackend(backendConfig)
+		if err != nil {
+			return nil, err
+		}
+	case backendKubelet:
+		backend = &kubeletBackend{kubeClient: kubeClient}
+	default:
+		return nil, errors.Errorf("unknown metrics backend %q", backendConfig.Name)
+	}
+
+	return &KubeMetrics{
+		context:       kubeContext,
+		cluster:       kubeCluster,
+		serverVersion: "unknown",
+		backend:       backend,
+		kubeClient:    kubeClient,
+	}, nil
 }
 
 func (k *KubeMetrics) GetMetrics() []PodMetrics {
@@ -55,66 +222,394 @@ func (k *KubeMetrics) GetMetrics() []PodMetrics {
 	return k.metrics
 }
 
-func (k *KubeMetrics) FetchMetrics() error {
+// LastFetched returns the time of the last successful metrics fetch.
+func (k *KubeMetrics) LastFetched() time.Time {
 	k.mu.Lock()
 	defer k.mu.Unlock()
+	return k.lastFetched
+}
 
-	if err := k.FetchResources(); err != nil {
-		return err
+// HeaderString returns a summary of the cluster we are connected to,
+// suitable for displaying in the application heading.
+func (k *KubeMetrics) HeaderString() string {
+	namespace := k.namespace
+	if namespace == "" {
+		namespace = "all"
 	}
+	k.mu.Lock()
+	serverVersion := k.serverVersion
+	k.mu.Unlock()
+	return fmt.Sprintf("context: %s | cluster: %s | namespace: %s | server: %s", k.context, k.cluster, namespace, serverVersion)
+}
 
-	metrics, err := k.metricsClient.Metrics().PodMetricses(k.namespace).List(metav1.ListOptions{})
-	if err != nil {
-		return errors.Wrapf(err, "unable to get pod metrics")
+// Node returns the details of a node.
+func (k *KubeMetrics) Node(name string) (NodeInfo, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	node, ok := k.nodes[name]
+	if !ok {
+		return NodeInfo{}, false
 	}
+	return *node, true
+}
 
-	k.metrics = []PodMetrics{}
-	for _, pod := range metrics.Items {
-		for _, c := range pod.Containers {
-			pr := PodMetrics{
-				Namespace: pod.Namespace,
-				Pod:       pod.Name,
-				Container: c.Name,
-				CPU:       c.Usage.Cpu().String(),
-				MEM:       fmt.Sprintf("%dMi", c.Usage.Memory().ScaledValue(resource.Mega)),
-				Usage:     c.Usage,
-			}
-			if resources, ok := k.resources[pr.UniqueID()]; ok {
-				pr.ResourceRequests = resources.ResourceRequests
-				pr.ResourceLimits = resources.ResourceLimits
-			}
-			k.metrics = append(k.metrics, pr)
-		}
+// Nodes returns the details of every node.
+func (k *KubeMetrics) Nodes() []NodeInfo {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	nodes := make([]NodeInfo, 0, len(k.nodes))
+	for _, node := range k.nodes {
+		nodes = append(nodes, *node)
+	}
+	return nodes
+}
+
+// Err returns the error from the last metrics fetch, if any.
+func (k *KubeMetrics) Err() error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.fetchErr
+}
+
+// FetchMetrics fetches the usage and resources of every container. The
+// results are only swapped in once everything has been fetched.
+func (k *KubeMetrics) FetchMetrics() error {
+	k.fetchServerVersion()
+
+	metrics, nodes, err := k.fetchMetrics()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.fetchErr = err
+	if err != nil {
+		return err
 	}
+	k.metrics = metrics
+	k.nodes = nodes
+	k.lastFetched = time.Now()
+	history.Prune(k.lastFetched)
 	return nil
 }
 
-func (k *KubeMetrics) FetchResources() error {
-	if k.fetchedResources {
-		return nil
+// fetchServerVersion fetches the server version until it is known. It is
+// only informational, so an unreachable cluster shouldn't stop us from
+// starting.
+func (k *KubeMetrics) fetchServerVersion() {
+	k.mu.Lock()
+	known := k.serverVersion != "unknown"
+	k.mu.Unlock()
+	if known {
+		return
+	}
+	info, err := k.kubeClient.Discovery().ServerVersion()
+	if err != nil {
+		return
 	}
+	k.mu.Lock()
+	k.serverVersion = info.GitVersion
+	k.mu.Unlock()
+}
+
+func (k *KubeMetrics) fetchMetrics() ([]PodMetrics, map[string]*NodeInfo, error) {
+	resources, nodes, err := k.FetchResources()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	usage, err := k.backend.FetchUsage(k.namespace)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics := []PodMetrics{}
+	for _, c := range usage {
+		pr := PodMetrics{
+			Cluster:   k.context,
+			Namespace: c.Namespace,
+			Pod:       c.Pod,
+			Container: c.Container,
+			CPU:       c.Usage.Cpu().String(),
+			MEM:       formatMEM(c.Usage.Memory().Value()),
+			Usage:     c.Usage,
+			Stats:     c.Stats,
+			Throttled: c.Throttled,
+		}
+		if resources, ok := resources[pr.UniqueID()]; ok {
+			pr.Node = resources.Node
+			pr.ContainerType = resources.ContainerType
+			pr.PodEffectiveRequests = resources.PodEffectiveRequests
+			pr.OwnerKind = resources.OwnerKind
+			pr.OwnerName = resources.OwnerName
+			pr.WorkloadKind = resources.WorkloadKind
+			pr.WorkloadName = resources.WorkloadName
+			pr.Autoscaler = resources.Autoscaler
+			pr.Created = resources.Created
+			pr.StartedAt = resources.StartedAt
+			pr.Restarts = resources.Restarts
+			pr.Status = resources.Status
+			pr.QOSClass = resources.QOSClass
+			pr.PriorityClass = resources.PriorityClass
+			pr.Priority = resources.Priority
+			pr.ResourceRequests = resources.ResourceRequests
+			pr.ResourceLimits = resources.ResourceLimits
+		}
+
+		sampleTime := c.Timestamp
+		if sampleTime.IsZero() {
+			sampleTime = time.Now()
+		}
+		history.Record(pr, sampleTime)
+		samples := history.Samples(pr.UniqueID())
+		updateLeak(&pr, samples)
+		updateThrottleRisk(&pr, samples)
+		metrics = append(metrics, pr)
+	}
+	for _, pr := range metrics {
+		if node, ok := nodes[pr.Node]; ok {
+			addResources(node.Usage, pr.Usage)
+		}
+	}
+	return metrics, nodes, nil
+}
 
+// FetchResources fetches the pod specs and statuses, keyed by
+// PodMetrics.UniqueID, and the nodes. This is done on every fetch so that
+// restart counts and new pods are kept up to date.
+func (k *KubeMetrics) FetchResources() (map[string]PodMetrics, map[string]*NodeInfo, error) {
 	pods, err := k.kubeClient.CoreV1().Pods(k.namespace).List(metav1.ListOptions{})
 	if err != nil {
-		return errors.Wrapf(err, "unable to get pod resources")
+		return nil, nil, errors.Wrapf(err, "unable to get pod resources")
 	}
 
 	podMetrics := make(map[string]PodMetrics)
 
+	// Listing nodes needs cluster wide permissions, so the node details
+	// are optional.
+	nodes := map[string]*NodeInfo{}
+	if nodeList, err := k.kubeClient.CoreV1().Nodes().List(metav1.ListOptions{}); err == nil {
+		for _, node := range nodeList.Items {
+			nodes[node.Name] = newNodeInfo(node)
+		}
+	}
+
+	workloads, autoscalers := k.fetchOwners()
+
 	for _, pod := range pods.Items {
-		for _, c := range pod.Spec.Containers {
+		restarts := map[string]int32{}
+		statuses := map[string]string{}
+		started := map[string]time.Time{}
+		for _, cs := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+			restarts[cs.Name] = cs.RestartCount
+			statuses[cs.Name] = containerStatus(cs)
+			if cs.State.Running != nil {
+				started[cs.Name] = cs.State.Running.StartedAt.Time
+			}
+		}
+		ownerKind, ownerName := "", ""
+		if owner := metav1.GetControllerOf(&pod); owner != nil {
+			ownerKind, ownerName = owner.Kind, owner.Name
+		}
+		workloadKind, workloadName := ownerKind, ownerName
+		if owner, ok := workloads[workloadKey(pod.Namespace, ownerKind, ownerName)]; ok {
+			workloadKind, workloadName = owner.Kind, owner.Name
+		}
+		autoscaler := autoscalers[workloadKey(pod.Namespace, workloadKind, workloadName)]
+		podRequests := effectiveRequests(&pod)
+		var priority int32
+		if pod.Spec.Priority != nil {
+			priority = *pod.Spec.Priority
+		}
+		if node, ok := nodes[pod.Spec.NodeName]; ok && pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			node.addPod(&pod)
+		}
+
+		addContainer := func(c corev1.Container, containerType string) {
 			pr := PodMetrics{
-				Pod:              pod.Name,
-				Node:             pod.Spec.NodeName,
-				Namespace:        pod.Namespace,
-				Container:        c.Name,
-				ResourceRequests: c.Resources.Requests,
-				ResourceLimits:   c.Resources.Limits,
+				Cluster:              k.context,
+				Pod:                  pod.Name,
+				Node:                 pod.Spec.NodeName,
+				Namespace:            pod.Namespace,
+				Container:            c.Name,
+				ContainerType:        containerType,
+				OwnerKind:            ownerKind,
+				OwnerName:            ownerName,
+				WorkloadKind:         workloadKind,
+				WorkloadName:         workloadName,
+				Autoscaler:           autoscaler,
+				Created:              pod.CreationTimestamp.Time,
+				StartedAt:            started[c.Name],
+				Restarts:             restarts[c.Name],
+				Status:               statuses[c.Name],
+				QOSClass:             string(pod.Status.QOSClass),
+				PriorityClass:        pod.Spec.PriorityClassName,
+				Priority:             priority,
+				ResourceRequests:     c.Resources.Requests,
+				ResourceLimits:       c.Resources.Limits,
+				PodEffectiveRequests: podRequests,
 			}
 			podMetrics[pr.UniqueID()] = pr
 		}
+		for _, c := range pod.Spec.InitContainers {
+			addContainer(c, ContainerTypeInit)
+		}
+		for _, c := range pod.Spec.Containers {
+			containerType := ContainerTypeApp
+			if sidecarNames[c.Name] {
+				containerType = ContainerTypeSidecar
+			}
+			addContainer(c, containerType)
+		}
 	}
-	k.resources = podMetrics
-	k.fetchedResources = true
-	return nil
+	return podMetrics, nodes, nil
+}
+
+// containerStatus returns the state of the container like kubectl, ie:
+// Running, CrashLoopBackOff or OOMKilled.
+func containerStatus(cs corev1.ContainerStatus) string {
+	switch {
+	case cs.State.Running != nil:
+		return "Running"
+	case cs.State.Waiting != nil:
+		return cs.State.Waiting.Reason
+	case cs.State.Terminated != nil:
+		return cs.State.Terminated.Reason
+	}
+	return "Unknown"
+}
+
+// statusSeverity ranks a container status so the worst status of a pod
+// can be found, higher is worse.
+func statusSeverity(status string) int {
+	switch status {
+	case "Running", "Completed":
+		return 0
+	case "", "Unknown", "ContainerCreating", "PodInitializing":
+		return 1
+	case "Error", "OOMKilled", "CrashLoopBackOff":
+		return 3
+	}
+	return 2
+}
+
+// aggregatePods combines the metrics of each pod's containers into a
+// single PodMetrics per pod, summing the usage, requests, limits and
+// restarts and keeping the worst container status.
+func aggregatePods(metrics []PodMetrics) []PodMetrics {
+	pods := []PodMetrics{}
+	index := map[string]int{}
+	sum := func(total, rl corev1.ResourceList) corev1.ResourceList {
+		result := corev1.ResourceList{}
+		for name, q := range total {
+			result[name] = q.DeepCopy()
+		}
+		for name, q := range rl {
+			t := result[name].DeepCopy()
+			t.Add(q)
+			result[name] = t
+		}
+		return result
+	}
+	for _, pm := range metrics {
+		i, ok := index[pm.PodID()]
+		if !ok {
+			i = len(pods)
+			index[pm.PodID()] = i
+			pods = append(pods, PodMetrics{
+				Cluster:              pm.Cluster,
+				Namespace:            pm.Namespace,
+				Pod:                  pm.Pod,
+				ContainerType:        "pod",
+				Node:                 pm.Node,
+				OwnerKind:            pm.OwnerKind,
+				OwnerName:            pm.OwnerName,
+				WorkloadKind:         pm.WorkloadKind,
+				WorkloadName:         pm.WorkloadName,
+				Autoscaler:           pm.Autoscaler,
+				Created:              pm.Created,
+				Status:               pm.Status,
+				QOSClass:             pm.QOSClass,
+				PriorityClass:        pm.PriorityClass,
+				Priority:             pm.Priority,
+				PodEffectiveRequests: pm.PodEffectiveRequests,
+			})
+		}
+		pod := &pods[i]
+		pod.ContainerCount++
+		pod.Restarts += pm.Restarts
+		pod.Usage = sum(pod.Usage, pm.Usage)
+		pod.ResourceRequests = sum(pod.ResourceRequests, pm.ResourceRequests)
+		pod.ResourceLimits = sum(pod.ResourceLimits, pm.ResourceLimits)
+		// The pod's uptime is the uptime of its most recently started
+		// container.
+		if pm.StartedAt.After(pod.StartedAt) {
+			pod.StartedAt = pm.StartedAt
+		}
+		// The pod's throttling is its most throttled container
+		pod.ThrottleRisk = maxPercent(pod.ThrottleRisk, pm.ThrottleRisk)
+		pod.Throttled = maxPercent(pod.Throttled, pm.Throttled)
+		// The pod's leak is its most likely leaking container
+		if pm.Leak != nil && (pod.Leak == nil || pm.Leak.Score > pod.Leak.Score) {
+			pod.Leak = pm.Leak
+		}
+		if statusSeverity(pm.Status) > statusSeverity(pod.Status) {
+			pod.Status = pm.Status
+		}
+	}
+	for i := range pods {
+		pods[i].CPU = pods[i].Usage.Cpu().String()
+		pods[i].MEM = formatMEM(pods[i].Usage.Memory().Value())
+	}
+	return pods
+}
+
+// effectiveRequests returns the requests the scheduler uses for the pod.
+// Init containers run one at a time before the app containers, so for
+// each resource this is the larger of the largest init container request
+// and the sum of the app container requests.
+func effectiveRequests(pod *corev1.Pod) corev1.ResourceList {
+	requests := corev1.ResourceList{}
+	for _, c := range pod.Spec.Containers {
+		for name, q := range c.Resources.Requests {
+			total := requests[name].DeepCopy()
+			total.Add(q)
+			requests[name] = total
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, q := range c.Resources.Requests {
+			if current, ok := requests[name]; !ok || q.Cmp(current) > 0 {
+				requests[name] = q.DeepCopy()
+			}
+		}
+	}
+	return requests
+}
+
+// FetchEvents fetches the events for the pod and the node it is
+// running on.
+func (k *KubeMetrics) FetchEvents(pm PodMetrics) ([]corev1.Event, error) {
+	podEvents, err := k.kubeClient.CoreV1().Events(pm.Namespace).List(metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pm.Pod,
+		}.String(),
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get pod events")
+	}
+	events := podEvents.Items
+
+	if pm.Node != "" {
+		nodeEvents, err := k.kubeClient.CoreV1().Events(metav1.NamespaceAll).List(metav1.ListOptions{
+			FieldSelector: fields.Set{
+				"involvedObject.kind": "Node",
+				"involvedObject.name": pm.Node,
+			}.String(),
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to get node events")
+		}
+		events = append(events, nodeEvents.Items...)
+	}
+	return events, nil
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const backendKubelet = "kubelet"
+
+// ContainerStats are the extra container stats only available from the
+// kubelet summary API. Network and ephemeral storage are per pod.
+type ContainerStats struct {
+	MEMRSSBytes        uint64
+	MEMWorkingSetBytes uint64
+	RootfsUsedBytes    uint64
+	LogsUsedBytes      uint64
+
+	PodEphemeralStorageUsedBytes uint64
+	PodNetworkRxBytes            uint64
+	PodNetworkTxBytes            uint64
+}
+
+// kubeletSummary is the subset of the kubelet's /stats/summary response
+// that we use.
+type kubeletSummary struct {
+	Pods []struct {
+		PodRef struct {
+			Name      string `json:"name"`
+			Namespace string `json:"namespace"`
+		} `json:"podRef"`
+		Containers []struct {
+			Name string `json:"name"`
+			CPU  *struct {
+				Time           metav1.Time `json:"time"`
+				UsageNanoCores *uint64     `json:"usageNanoCores"`
+			} `json:"cpu"`
+			Memory *struct {
+				Time            metav1.Time `json:"time"`
+				WorkingSetBytes *uint64     `json:"workingSetBytes"`
+				RSSBytes        *uint64     `json:"rssBytes"`
+			} `json:"memory"`
+			Rootfs *kubeletFsStats `json:"rootfs"`
+			Logs   *kubeletFsStats `json:"logs"`
+		} `json:"containers"`
+		Network *struct {
+			RxBytes *uint64 `json:"rxBytes"`
+			TxBytes *uint64 `json:"txBytes"`
+		} `json:"network"`
+		EphemeralStorage *kubeletFsStats `json:"ephemeral-storage"`
+	} `json:"pods"`
+}
+
+type kubeletFsStats struct {
+	UsedBytes *uint64 `json:"usedBytes"`
+}
+
+func (f *kubeletFsStats) used() uint64 {
+	if f == nil || f.UsedBytes == nil {
+		return 0
+	}
+	return *f.UsedBytes
+}
+
+func uint64Value(v *uint64) uint64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
+
+// kubeletBackend fetches the usage from each node's kubelet summary API,
+// proxied through the API server. This gives richer stats than the
+// metrics API.
+type kubeletBackend struct {
+	kubeClient *kubernetes.Clientset
+}
+
+func (b *kubeletBackend) FetchUsage(namespace string) ([]ContainerUsage, error) {
+	nodes, err := b.kubeClient.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get nodes")
+	}
+
+	var wg sync.WaitGroup
+	summaries := make([]*kubeletSummary, len(nodes.Items))
+	errs := make([]error, len(nodes.Items))
+	for i, node := range nodes.Items {
+		wg.Add(1)
+		go func(i int, node string) {
+			defer wg.Done()
+			summaries[i], errs[i] = b.fetchSummary(node)
+		}(i, node.Name)
+	}
+	wg.Wait()
+
+	// A single unreachable node shouldn't hide the rest of the cluster
+	usage := []ContainerUsage{}
+	var fetchErr error
+	for i, summary := range summaries {
+		if errs[i] != nil {
+			fetchErr = errs[i]
+			continue
+		}
+		usage = append(usage, summaryUsage(summary, namespace)...)
+	}
+	if len(usage) == 0 && fetchErr != nil {
+		return nil, fetchErr
+	}
+	return usage, nil
+}
+
+func (b *kubeletBackend) fetchSummary(node string) (*kubeletSummary, error) {
+	data, err := b.kubeClient.CoreV1().RESTClient().Get().
+		Resource("nodes").
+		Name(node).
+		SubResource("proxy").
+		Suffix("stats", "summary").
+		DoRaw()
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get kubelet stats for node %s", node)
+	}
+	var summary kubeletSummary
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode kubelet stats for node %s", node)
+	}
+	return &summary, nil
+}
+
+// summaryUsage converts a kubelet summary to the usage of each container
+// in namespace, or all namespaces if namespace is empty.
+func summaryUsage(summary *kubeletSummary, namespace string) []ContainerUsage {
+	usage := []ContainerUsage{}
+	for _, pod := range summary.Pods {
+		if namespace != "" && pod.PodRef.Namespace != namespace {
+			continue
+		}
+		var rx, tx uint64
+		if pod.Network != nil {
+			rx, tx = uint64Value(pod.Network.RxBytes), uint64Value(pod.Network.TxBytes)
+		}
+		for _, c := range pod.Containers {
+			var timestamp time.Time
+			var cpuNanoCores, rss, workingSet uint64
+			if c.CPU != nil {
+				timestamp = c.CPU.Time.Time
+				cpuNanoCores = uint64Value(c.CPU.UsageNanoCores)
+			}
+			if c.Memory != nil {
+				rss = uint64Value(c.Memory.RSSBytes)
+				workingSet = uint64Value(c.Memory.WorkingSetBytes)
+			}
+			usage = append(usage, ContainerUsage{
+				Namespace: pod.PodRef.Namespace,
+				Pod:       pod.PodRef.Name,
+				Container: c.Name,
+				Timestamp: timestamp,
+				// Memory usage is the working set, the same as the
+				// metrics API.
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewMilliQuantity(int64(cpuNanoCores/1e6), resource.DecimalSI),
+					corev1.ResourceMemory: *resource.NewQuantity(int64(workingSet), resource.BinarySI),
+				},
+				Stats: &ContainerStats{
+					MEMRSSBytes:                  rss,
+					MEMWorkingSetBytes:           workingSet,
+					RootfsUsedBytes:              c.Rootfs.used(),
+					LogsUsedBytes:                c.Logs.used(),
+					PodEphemeralStorageUsedBytes: pod.EphemeralStorage.used(),
+					PodNetworkRxBytes:            rx,
+					PodNetworkTxBytes:            tx,
+				},
+			})
+		}
+	}
+	return usage
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// minLeakSamples is the number of samples needed before looking for
+	// a leak.
+	minLeakSamples = 10
+
+	// leakScoreThreshold is the leak score above which a container is
+	// flagged as leaking.
+	leakScoreThreshold = 70
+
+	// leakTolerance is how much the memory can drop between samples and
+	// still count as growing, to allow for small collections.
+	leakTolerance = 0.01
+)
+
+// Leak is the memory trend of a container over the history window.
+type Leak struct {
+	// Growth is the fitted memory growth in bytes per second
+	Growth float64
+	// Score is from 0 to 100, how steadily the memory is growing; it is
+	// the fraction of samples that didn't drop multiplied by how well
+	// the trend fits, 0 if the memory isn't growing.
+	Score float64
+	// ETA is the estimated time until the memory limit is reached, only
+	// set if the container has a memory limit and is growing.
+	ETA    time.Duration
+	HasETA bool
+}
+
+// Leaking returns whether the container is likely leaking memory.
+func (l *Leak) Leaking() bool {
+	return l != nil && l.Score >= leakScoreThreshold
+}
+
+// detectLeak fits a linear trend to the memory samples and estimates
+// when the memory will reach limit, a limit of 0 means no limit. False
+// is returned if there aren't enough samples.
+func detectLeak(samples []Sample, limit int64) (Leak, bool) {
+	if len(samples) < minLeakSamples {
+		return Leak{}, false
+	}
+
+	// Least squares fit of memory against seconds since the first sample
+	start := samples[0].Time
+	n := float64(len(samples))
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(start).Seconds()
+		y := float64(s.MEM)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return Leak{}, false
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	intercept := (sumY - slope*sumX) / n
+
+	leak := Leak{Growth: slope}
+	if slope <= 0 {
+		return leak, true
+	}
+
+	// How much of the variance the trend explains
+	mean := sumY / n
+	var residual, total float64
+	for _, s := range samples {
+		x := s.Time.Sub(start).Seconds()
+		y := float64(s.MEM)
+		residual += (y - (slope*x + intercept)) * (y - (slope*x + intercept))
+		total += (y - mean) * (y - mean)
+	}
+	fit := 1.0
+	if total > 0 {
+		fit = 1 - residual/total
+	}
+	if fit < 0 {
+		fit = 0
+	}
+
+	growing := 0
+	for i := 1; i < len(samples); i++ {
+		if float64(samples[i].MEM) >= float64(samples[i-1].MEM)*(1-leakTolerance) {
+			growing++
+		}
+	}
+	leak.Score = float64(growing) / float64(len(samples)-1) * fit * 100
+
+	last := samples[len(samples)-1].MEM
+	if limit > 0 {
+		leak.HasETA = true
+		if last < limit {
+			leak.ETA = time.Duration(float64(limit-last) / slope * float64(time.Second))
+		}
+	}
+	return leak, true
+}
+
+// updateLeak sets the container's leak from its history samples.
+func updateLeak(pm *PodMetrics, samples []Sample) {
+	leak, ok := detectLeak(samples, pm.ResourceLimits.Memory().Value())
+	if ok {
+		pm.Leak = &leak
+	}
+}
+
+// formatLeakETA formats the time until the memory limit is reached for
+// leaking containers, ie: limit in ~42m.
+func formatLeakETA(l *Leak) string {
+	if !l.Leaking() || !l.HasETA {
+		return ""
+	}
+	if l.ETA <= 0 {
+		return "at limit"
+	}
+	return "limit in ~" + formatAge(l.ETA)
+}
+
+func formatLeakScore(l *Leak) string {
+	if l == nil {
+		return ""
+	}
+	return fmt.Sprintf("%.0f", l.Score)
+}
+
+// compareLeakETA orders leaking containers by how soon they reach their
+// memory limit, containers that aren't leaking are last.
+func compareLeakETA(pi, pj PodMetrics) int {
+	eta := func(l *Leak) int64 {
+		if !l.Leaking() || !l.HasETA {
+			return 1<<63 - 1
+		}
+		return int64(l.ETA)
+	}
+	return compareInt64(eta(pi.Leak), eta(pj.Leak))
+}
+
+func compareLeakScore(pi, pj PodMetrics) int {
+	score := func(l *Leak) func() (float64, bool) {
+		return func() (float64, bool) {
+			if l == nil {
+				return 0, false
+			}
+			return l.Score, true
+		}
+	}
+	return comparePercent(score(pi.Leak), score(pj.Leak))
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	termbox "github.com/nsf/termbox-go"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// maxLogLines is the most log lines kept in memory for a log view
+	maxLogLines = 10000
+)
+
+var (
+	// logView is the log pane currently open, nil when closed
+	logView *LogView
+
+	logTailLines int64 = 500
+)
+
+// LogView is a scrollable pane showing the logs of a single container.
+type LogView struct {
+	pm   PodMetrics
+	kube *KubeMetrics
+
+	previous bool
+	follow   bool
+
+	mu     sync.Mutex
+	lines  []string
+	err    error
+	stream io.ReadCloser
+	// generation is incremented each time the stream is stopped, so
+	// that an old stream can tell it is no longer wanted.
+	generation int
+
+	// top is the index of the first line displayed, when tail is set
+	// the view stays scrolled to the last line.
+	top  int
+	tail bool
+
+	searchMode bool
+	search     string
+}
+
+// openLogView opens a log pane for the selected container.
+func openLogView() {
+	pm, ok := selectedPodMetrics()
+	if !ok {
+		return
+	}
+	if pm.ContainerCount > 0 {
+		statusString = "press ENTER to select one of the pod's containers to view its logs"
+		return
+	}
+	kube := kubeMetrics.Get(pm.Cluster)
+	if kube == nil {
+		return
+	}
+	l := &LogView{
+		pm:     pm,
+		kube:   kube,
+		follow: true,
+		tail:   true,
+	}
+
+	updateLock.Lock()
+	logView = l
+	updateLock.Unlock()
+
+	l.start()
+}
+
+func closeLogView() {
+	updateLock.Lock()
+	l := logView
+	logView = nil
+	updateLock.Unlock()
+
+	if l != nil {
+		l.stop()
+	}
+}
+
+// start (re)starts streaming the logs with the current options.
+func (l *LogView) start() {
+	l.stop()
+
+	l.mu.Lock()
+	l.lines = nil
+	l.err = nil
+	l.top = 0
+	generation := l.generation
+	follow, previous := l.follow, l.previous
+	l.mu.Unlock()
+
+	req := l.kube.kubeClient.CoreV1().Pods(l.pm.Namespace).GetLogs(l.pm.Pod, &corev1.PodLogOptions{
+		Container: l.pm.Container,
+		Follow:    follow,
+		Previous:  previous,
+		TailLines: &logTailLines,
+	})
+	go func() {
+		stream, err := req.Stream()
+		l.mu.Lock()
+		if l.generation != generation {
+			l.mu.Unlock()
+			if stream != nil {
+				stream.Close()
+			}
+			return
+		}
+		if err != nil {
+			l.err = err
+			l.mu.Unlock()
+			requestRedraw()
+			return
+		}
+		l.stream = stream
+		l.mu.Unlock()
+
+		scanner := bufio.NewScanner(stream)
+		for scanner.Scan() {
+			l.mu.Lock()
+			// A newer stream has been started, or the view closed
+			if l.generation != generation {
+				l.mu.Unlock()
+				return
+			}
+			l.lines = append(l.lines, strings.Replace(scanner.Text(), "\t", "    ", -1))
+			if len(l.lines) > maxLogLines {
+				dropped := len(l.lines) - maxLogLines
+				l.lines = l.lines[dropped:]
+				l.top -= dropped
+				if l.top < 0 {
+					l.top = 0
+				}
+			}
+			l.mu.Unlock()
+			requestRedraw()
+		}
+	}()
+}
+
+func (l *LogView) stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.generation++
+	if l.stream != nil {
+		l.stream.Close()
+		l.stream = nil
+	}
+}
+
+func (l *LogView) pageSize() int {
+	// Leave room for the heading and the footer
+	return termHeight - 3
+}
+
+// scroll moves the view by i lines, scrolling to the end starts tailing
+// the logs again.
+func (l *LogView) scroll(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	maxTop := len(l.lines) - l.pageSize()
+	if maxTop < 0 {
+		maxTop = 0
+	}
+	if l.tail {
+		l.top = maxTop
+	}
+	l.top += i
+	if l.top < 0 {
+		l.top = 0
+	}
+	l.tail = l.top >= maxTop
+	if l.tail {
+		l.top = maxTop
+	}
+}
+
+// findMatch scrolls to the next line, in the direction of i, that
+// matches the search string.
+func (l *LogView) findMatch(i int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.search == "" {
+		return
+	}
+	for n := l.top + i; n >= 0 && n < len(l.lines); n += i {
+		if strings.Contains(l.lines[n], l.search) {
+			l.top = n
+			l.tail = false
+			return
+		}
+	}
+}
+
+// handleLogKey handles a key press while the log view is open.
+func handleLogKey(ev termbox.Event) {
+	l := logView
+
+	l.mu.Lock()
+	searchMode := l.searchMode
+	if searchMode {
+		switch ev.Key {
+		case termbox.KeyEnter:
+			l.searchMode = false
+		case termbox.KeyEsc:
+			l.searchMode = false
+			l.search = ""
+		case termbox.KeyBackspace, termbox.KeyBackspace2:
+			if len(l.search) > 0 {
+				l.search = l.search[:len(l.search)-1]
+			}
+		case termbox.KeySpace:
+			l.search += " "
+		default:
+			if ev.Ch != 0 {
+				l.search += string(ev.Ch)
+			}
+		}
+	}
+	l.mu.Unlock()
+
+	if searchMode {
+		if ev.Key == termbox.KeyEnter {
+			l.findMatch(1)
+		}
+		return
+	}
+
+	switch ev.Key {
+	case termbox.KeyEsc:
+		closeLogView()
+	case termbox.KeyArrowUp:
+		l.scroll(-1)
+	case termbox.KeyArrowDown:
+		l.scroll(1)
+	case termbox.KeyPgup:
+		l.scroll(-l.pageSize())
+	case termbox.KeyPgdn:
+		l.scroll(l.pageSize())
+	case termbox.KeyHome:
+		l.scroll(-maxLogLines)
+	case termbox.KeyEnd:
+		l.scroll(maxLogLines)
+	default:
+		switch ev.Ch {
+		case 'q':
+			closeLogView()
+		case '/':
+			l.mu.Lock()
+			l.searchMode = true
+			l.search = ""
+			l.mu.Unlock()
+		case 'n':
+			l.findMatch(1)
+		case 'N':
+			l.findMatch(-1)
+		case 'f':
+			l.mu.Lock()
+			l.follow = !l.follow
+			l.tail = true
+			l.mu.Unlock()
+			l.start()
+		case 'p':
+			l.mu.Lock()
+			l.previous = !l.previous
+			l.tail = true
+			l.mu.Unlock()
+			l.start()
+		}
+	}
+}
+
+// drawLogView draws the log pane over the whole screen.
+func drawLogView(l *LogView) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	yesNo := func(b bool) string {
+		if b {
+			return "yes"
+		}
+		return "no"
+	}
+	headerString := fmt.Sprintf(
+		"logs: %s/%s/%s | follow: %s | previous: %s | tail: %d | search: %s",
+		l.pm.Namespace, l.pm.Pod, l.pm.Container,
+		yesNo(l.follow), yesNo(l.previous), logTailLines, l.search,
+	)
+	if l.searchMode {
+		headerString += "_"
+	}
+	outputWord(headerString, 0, 0, headerColor)
+
+	if l.err != nil {
+		outputWord(fmt.Sprintf("unable to get logs: %s", l.err), 0, 1, normalColor)
+	}
+
+	pageSize := l.pageSize()
+	if l.tail {
+		l.top = len(l.lines) - pageSize
+		if l.top < 0 {
+			l.top = 0
+		}
+	}
+	for y := 0; y < pageSize && l.top+y < len(l.lines); y++ {
+		line := l.lines[l.top+y]
+		color := normalColor
+		if l.search != "" && strings.Contains(line, l.search) {
+			color = highlightedColor
+		}
+		outputWord(line, 0, y+1, color)
+	}
+
+	footerString := "(ESC) Close | (UP/DOWN/PGUP/PGDN/HOME/END) Scroll | (/) Search | (n/N) Next/Prev match | (f) Follow | (p) Previous container"
+	if l.searchMode {
+		footerString = "Searching: (ENTER) Find | (ESC) Clear"
+	}
+	outputWord(footerString, 0, termHeight-2, footerColor)
+}
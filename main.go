@@ -1,19 +1,20 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
 	"os"
+	"strings"
 	"time"
 
 	termbox "github.com/nsf/termbox-go"
+	"github.com/pkg/errors"
 
 	// Kubernetes
-	"k8s.io/client-go/kubernetes"
+	"k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/client-go/tools/clientcmd"
 
-	// Kubernetes metrics
-	metricsclientset "k8s.io/metrics/pkg/client/clientset_generated/clientset"
-
 	// GKE authentication
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp"
 )
@@ -23,52 +24,170 @@ const (
 )
 
 var (
-	kubeMetrics KubeMetrics
+	kubeMetrics Clusters
+
+	// redraw is used to request the screen be redrawn from the background
+	redraw = make(chan struct{}, 1)
 )
 
+// requestRedraw asks for the screen to be redrawn without blocking,
+// multiple requests before the redraw are merged.
+func requestRedraw() {
+	select {
+	case redraw <- struct{}{}:
+	default:
+	}
+}
+
+// stringsFlag is a flag that can be specified multiple times.
+type stringsFlag []string
+
+func (s *stringsFlag) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringsFlag) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
 func main() {
-	kubeConfig := ""
-	kubeContext := ""
+	var kubeContexts stringsFlag
+	var alertRules stringsFlag
+	kubeConfig := flag.String("kubeconfig", "", "path to the kubeconfig file, defaults to $KUBECONFIG or ~/.kube/config")
+	flag.Var(&kubeContexts, "context", "kubeconfig context to use, can be repeated to view several clusters at once")
+	var backendConfig BackendConfig
+	flag.StringVar(&backendConfig.Name, "backend", backendMetricsServer, "where to fetch the container usage from, either metrics-server, prometheus or kubelet")
+	flag.StringVar(&backendConfig.PrometheusURL, "prometheus-url", "", "url of the prometheus server for the prometheus backend, ie: http://localhost:9090")
+	flag.StringVar(&backendConfig.PrometheusCPUQuery, "prometheus-cpu-query", defaultPrometheusCPUQuery, "prometheus query for the cpu usage in cores per namespace, pod and container")
+	flag.StringVar(&backendConfig.PrometheusMEMQuery, "prometheus-mem-query", defaultPrometheusMEMQuery, "prometheus query for the memory usage in bytes per namespace, pod and container")
+	flag.StringVar(&backendConfig.PrometheusThrottleQuery, "prometheus-throttle-query", defaultPrometheusThrottleQuery, "prometheus query for the fraction of cfs periods throttled per namespace, pod and container")
+	configPath := flag.String("config", defaultConfigPath(), "path to the ktop config file")
+	themeName := flag.String("theme", "", "colour theme, one of: "+strings.Join(themeNames(), ", "))
+	flag.Var(&alertRules, "alert", `alert rule, ie: "mem > 90% of limit for 30s", can be repeated`)
+	listenAddr := flag.String("listen", "", "address to serve the metrics in the Prometheus format on, ie: :9090")
+	bestEffortMem := flag.String("besteffort-memory", bestEffortMemThreshold.String(), "highlight BestEffort containers using at least this much memory")
+	flag.BoolVar(&readOnly, "read-only", false, "disable actions that change the cluster, ie: deleting pods")
+	flag.Int64Var(&logTailLines, "log-tail-lines", logTailLines, "number of log lines to show when opening a container's logs")
+	historyWindow := flag.Duration("history", time.Hour, "how long to keep usage history for, used for recommendations and leak detection")
+	flag.StringVar(&recommendationsDir, "recommendations-dir", recommendationsDir, "directory to export the recommended requests and limits to, as a patch per workload")
+	colors := flag.Int("colors", 0, "number of colours to use, either 8 or 256, defaults to guessing from $TERM")
+	flag.Parse()
+
+	history.SetWindow(*historyWindow)
+
+	threshold, err := resource.ParseQuantity(*bestEffortMem)
+	if err != nil {
+		log.Fatalf("invalid --besteffort-memory: %s", err)
+	}
+	bestEffortMemThreshold = threshold
+
+	config, err := loadConfig(*configPath)
+	if err != nil {
+		log.Fatalf("unable to load config: %s", err)
+	}
+	if err := applyKeyBindings(config.Keys); err != nil {
+		log.Fatalf("invalid key bindings: %s", err)
+	}
+
+	if config.Sidecars != nil {
+		sidecarNames = map[string]bool{}
+		for _, name := range config.Sidecars {
+			sidecarNames[name] = true
+		}
+	}
+
+	for _, a := range config.Alerts {
+		rule, err := ParseAlertRule(a.Rule, a.Command)
+		if err != nil {
+			log.Fatalf("invalid alert: %s", err)
+		}
+		alerts.AddRule(rule)
+	}
+	for _, r := range alertRules {
+		rule, err := ParseAlertRule(r, "")
+		if err != nil {
+			log.Fatalf("invalid alert: %s", err)
+		}
+		alerts.AddRule(rule)
+	}
+
+	// An explicit --theme takes precedence over NO_COLOR, which takes
+	// precedence over the config file.
+	if *themeName == "" {
+		switch {
+		case noColor():
+			*themeName = "monochrome"
+		case config.Theme != "":
+			*themeName = config.Theme
+		default:
+			*themeName = defaultTheme
+		}
+	}
+	if *colors == 0 {
+		*colors = config.Colors
+	}
+	if *colors == 0 {
+		*colors = 8
+		if supports256Colors() {
+			*colors = 256
+		}
+	}
+	outputMode, err := applyTheme(*themeName, *colors)
+	if err != nil {
+		log.Fatalf("invalid theme: %s", err)
+	}
 
 	// Determine kubeconfig path
-	if kubeConfig == "" {
+	if *kubeConfig == "" {
 		if os.Getenv("KUBECONFIG") != "" {
-			kubeConfig = os.Getenv("KUBECONFIG")
+			*kubeConfig = os.Getenv("KUBECONFIG")
 		} else {
-			kubeConfig = clientcmd.RecommendedHomeFile
+			*kubeConfig = clientcmd.RecommendedHomeFile
 		}
 	}
-	// Create the kubernetes client configuration
-	clientConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{
-			ExplicitPath: kubeConfig,
-		},
-		&clientcmd.ConfigOverrides{
-			CurrentContext: kubeContext,
-		},
-	).ClientConfig()
-	if err != nil {
-		log.Fatalf("unable to create k8s client config: %s", err)
-	}
 
-	kubeClient, err := kubernetes.NewForConfig(clientConfig)
-	if err != nil {
-		log.Fatalf("unable to create k8s client: %s\n", err)
+	// An empty context will use the current context from the kubeconfig
+	if len(kubeContexts) == 0 {
+		kubeContexts = stringsFlag{""}
+	}
+	// Every context would query the same Prometheus server, so each
+	// container would be shown once per context.
+	if backendConfig.Name == backendPrometheus && len(kubeContexts) > 1 {
+		log.Fatalf("the prometheus backend can only be used with a single --context")
 	}
 
 	log.Printf("connecting to kubernetes cluster metrics")
-	metricsClient, err := metricsclientset.NewForConfig(clientConfig)
-	if err != nil {
-		log.Fatalf("unable to create metrics client: %s", err)
+	for _, kubeContext := range kubeContexts {
+		km, err := NewKubeMetrics(*kubeConfig, kubeContext, backendConfig)
+		if err != nil {
+			log.Fatalf("unable to connect to kubernetes context %q: %s", kubeContext, err)
+		}
+		kubeMetrics = append(kubeMetrics, km)
 	}
-
-	kubeMetrics = KubeMetrics{
-		metricsClient: metricsClient,
-		kubeClient:    kubeClient,
+	statsAvailable = backendConfig.Name == backendKubelet
+	throttlingAvailable = backendConfig.Name == backendPrometheus
+	if len(kubeMetrics) > 1 {
+		displayHeaders = append([]*DisplayHeader{clusterHeader}, displayHeaders...)
 	}
+
 	if err := kubeMetrics.FetchMetrics(); err != nil {
+		if errors.Cause(err) == errNoMetricsAPI {
+			fmt.Fprintf(os.Stderr, "%s\n\n", err)
+			fmt.Fprintf(os.Stderr, "ktop needs the metrics API to get container usage, install metrics-server:\n")
+			fmt.Fprintf(os.Stderr, "    https://github.com/kubernetes-incubator/metrics-server\n")
+			fmt.Fprintf(os.Stderr, "or use another backend with --backend prometheus or --backend kubelet\n")
+			os.Exit(1)
+		}
 		log.Fatalf("unable to get kubernetes metrics: %s", err)
 	}
+	alerts.Evaluate(kubeMetrics.GetMetrics(), time.Now())
+
+	if *listenAddr != "" {
+		if err := startExporter(*listenAddr); err != nil {
+			log.Fatalf("unable to start metrics server: %s", err)
+		}
+	}
 
 	if err := termbox.Init(); err != nil {
 		log.Fatalf("error init termbox: %s", err)
@@ -78,11 +197,21 @@ func main() {
 	termWidth, termHeight = termbox.Size()
 
 	termbox.SetInputMode(termbox.InputEsc | termbox.InputAlt | termbox.InputMouse)
+	termbox.SetOutputMode(outputMode)
+
+	go func() {
+		for range redraw {
+			updateScreen()
+		}
+	}()
 
 	go func() {
 		updateScreen()
 		for range time.NewTicker(time.Second * watchSeconds).C {
 			kubeMetrics.FetchMetrics()
+			alerts.Evaluate(kubeMetrics.GetMetrics(), time.Now())
+			refreshEvents()
+			refreshQuotas()
 			updateScreen()
 		}
 	}()
@@ -96,34 +225,8 @@ func main() {
 			termWidth, termHeight = ev.Width, ev.Height
 			updateScreen()
 		case termbox.EventKey:
-			switch ev.Key {
-			case termbox.KeyEsc:
+			if !handleKey(ev) {
 				return
-			case termbox.KeySpace:
-				snapshot()
-			case termbox.KeyBackspace, termbox.KeyBackspace2:
-				if len(filterString) > 0 {
-					filterString = filterString[:len(filterString)-1]
-				}
-			case termbox.KeyArrowDown:
-				updateSelectedID(1)
-			case termbox.KeyArrowUp:
-				updateSelectedID(-1)
-			default:
-				switch ch := ev.Ch; ch {
-				case '1': // key 1
-					setOrderOption(OrderCPUDec)
-				case '2': // key 2
-					setOrderOption(OrderCPUAsc)
-				case '3': // key 3
-					setOrderOption(OrderMEMDec)
-				case '4': // key 4
-					setOrderOption(OrderMEMAsc)
-				default:
-					if (ch >= 'a' && ch <= 'z') || ch == '-' || ch == '_' {
-						filterString += string(ch)
-					}
-				}
 			}
 			updateScreen()
 		}
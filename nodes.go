@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// nodeMode groups the containers under the node they are running on
+var nodeMode bool
+
+// NodeInfo is the allocatable resources and conditions of a node, along
+// with the totals of the pods scheduled on it.
+type NodeInfo struct {
+	Name        string
+	Allocatable corev1.ResourceList
+	PodCapacity int64
+	// Conditions are the node conditions that are problems, ie:
+	// MemoryPressure or NotReady.
+	Conditions []string
+
+	PodCount int
+	// Requests and Limits are the sum of the pods' requests and limits
+	Requests corev1.ResourceList
+	Limits   corev1.ResourceList
+	// Usage is the sum of the containers' usage
+	Usage corev1.ResourceList
+}
+
+// newNodeInfo creates the NodeInfo for a node, without any pod totals.
+func newNodeInfo(node corev1.Node) *NodeInfo {
+	info := &NodeInfo{
+		Name:        node.Name,
+		Allocatable: node.Status.Allocatable,
+		PodCapacity: node.Status.Allocatable.Pods().Value(),
+		Requests:    corev1.ResourceList{},
+		Limits:      corev1.ResourceList{},
+		Usage:       corev1.ResourceList{},
+	}
+	for _, c := range node.Status.Conditions {
+		switch {
+		case c.Type == corev1.NodeReady && c.Status != corev1.ConditionTrue:
+			info.Conditions = append(info.Conditions, "NotReady")
+		case c.Type != corev1.NodeReady && c.Status == corev1.ConditionTrue:
+			info.Conditions = append(info.Conditions, string(c.Type))
+		}
+	}
+	return info
+}
+
+// addResources adds rl to the total in place.
+func addResources(total, rl corev1.ResourceList) {
+	for name, q := range rl {
+		t := total[name].DeepCopy()
+		t.Add(q)
+		total[name] = t
+	}
+}
+
+// addPod adds the pod's requests and limits to the node totals.
+func (n *NodeInfo) addPod(pod *corev1.Pod) {
+	n.PodCount++
+	addResources(n.Requests, effectiveRequests(pod))
+	for _, c := range pod.Spec.Containers {
+		addResources(n.Limits, c.Resources.Limits)
+	}
+}
+
+// ratio returns used as a percentage of the node's allocatable resource,
+// false is returned if the node has none of the resource allocatable.
+func (n *NodeInfo) ratio(used corev1.ResourceList, name corev1.ResourceName) (float64, bool) {
+	allocatable := n.Allocatable[name]
+	q := used[name]
+	return percentOf(&q, &allocatable)
+}
+
+// Heading summarises the node for the node grouped layout.
+func (n *NodeInfo) Heading() string {
+	heading := fmt.Sprintf(
+		"node %s | usage cpu=%s mem=%s | requests cpu=%s/%s (%s) mem=%s/%s (%s) | pods %d/%d",
+		n.Name,
+		formatQuantityCPU(n.Usage), formatQuantityMEM(n.Usage),
+		formatQuantityCPU(n.Requests), formatQuantityCPU(n.Allocatable), formatPercent(n.ratio(n.Requests, corev1.ResourceCPU)),
+		formatQuantityMEM(n.Requests), formatQuantityMEM(n.Allocatable), formatPercent(n.ratio(n.Requests, corev1.ResourceMemory)),
+		n.PodCount, n.PodCapacity,
+	)
+	if len(n.Conditions) > 0 {
+		heading += " | " + strings.Join(n.Conditions, ", ")
+	}
+	return heading
+}
+
+func formatQuantityCPU(rl corev1.ResourceList) string {
+	return formatMilliCPU(rl.Cpu().MilliValue())
+}
+
+func formatQuantityMEM(rl corev1.ResourceList) string {
+	return formatMEM(rl.Memory().Value())
+}
+
+// tableLine is a line of the table, either a row of podMetrics at index
+// or a heading when index is -1.
+type tableLine struct {
+	index   int
+	heading string
+	// warning highlights the heading
+	warning bool
+}
+
+// groupRows groups the rows under a heading for each group, ordered by
+// the group key. The heading is made from the first row in the group.
+// The first pinned rows are kept at the top.
+func groupRows(rows []PodMetrics, pinned int, key func(PodMetrics) string, heading func(PodMetrics) tableLine) []tableLine {
+	lines := make([]tableLine, 0, len(rows))
+	for i := 0; i < pinned; i++ {
+		lines = append(lines, tableLine{index: i})
+	}
+
+	groups := map[string][]int{}
+	keys := []string{}
+	for i := pinned; i < len(rows); i++ {
+		k := key(rows[i])
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], i)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		lines = append(lines, heading(rows[groups[k][0]]))
+		for _, i := range groups[k] {
+			lines = append(lines, tableLine{index: i})
+		}
+	}
+	return lines
+}
+
+// groupByNode groups the rows under a heading for each node, ordered by
+// cluster and node name. The first pinned rows are kept at the top.
+func groupByNode(rows []PodMetrics, pinned int) []tableLine {
+	return groupRows(rows, pinned,
+		func(pm PodMetrics) string { return pm.Cluster + "/" + pm.Node },
+		func(pm PodMetrics) tableLine {
+			line := tableLine{index: -1, heading: "node " + pm.Node}
+			if pm.Node == "" {
+				line.heading = "unknown node"
+			}
+			if kube := kubeMetrics.Get(pm.Cluster); kube != nil {
+				if info, ok := kube.Node(pm.Node); ok {
+					line.heading = info.Heading()
+					line.warning = len(info.Conditions) > 0
+				}
+			}
+			if len(kubeMetrics) > 1 {
+				line.heading = pm.Cluster + " " + line.heading
+			}
+			return line
+		},
+	)
+}
+
+func toggleNodeMode() {
+	nodeMode = !nodeMode
+	ownerMode = false
+}
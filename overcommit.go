@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// overcommitView shows the node overcommit report over the whole screen
+var overcommitView bool
+
+// nodeOvercommit is a node's requests, limits and usage as percentages
+// of its allocatable resources.
+type nodeOvercommit struct {
+	cluster string
+	node    NodeInfo
+
+	memLimits, memRequests, memUsage float64
+	cpuLimits, cpuRequests, cpuUsage float64
+}
+
+func newNodeOvercommit(cluster string, node NodeInfo) nodeOvercommit {
+	ratio := func(used corev1.ResourceList, name corev1.ResourceName) float64 {
+		r, _ := node.ratio(used, name)
+		return r
+	}
+	return nodeOvercommit{
+		cluster:     cluster,
+		node:        node,
+		memLimits:   ratio(node.Limits, corev1.ResourceMemory),
+		memRequests: ratio(node.Requests, corev1.ResourceMemory),
+		memUsage:    ratio(node.Usage, corev1.ResourceMemory),
+		cpuLimits:   ratio(node.Limits, corev1.ResourceCPU),
+		cpuRequests: ratio(node.Requests, corev1.ResourceCPU),
+		cpuUsage:    ratio(node.Usage, corev1.ResourceCPU),
+	}
+}
+
+// overcommitReport returns every node ranked by how likely it is to
+// start OOM killing under load; memory can't be throttled like CPU, so
+// nodes are ranked by memory limits against allocatable, then by memory
+// usage.
+func overcommitReport() []nodeOvercommit {
+	report := []nodeOvercommit{}
+	for _, k := range kubeMetrics {
+		for _, node := range k.Nodes() {
+			report = append(report, newNodeOvercommit(k.context, node))
+		}
+	}
+	sort.Slice(report, func(i, j int) bool {
+		ri, rj := report[i], report[j]
+		if ri.memLimits != rj.memLimits {
+			return ri.memLimits > rj.memLimits
+		}
+		if ri.memUsage != rj.memUsage {
+			return ri.memUsage > rj.memUsage
+		}
+		return ri.node.Name < rj.node.Name
+	})
+	return report
+}
+
+func toggleOvercommitView() {
+	overcommitView = !overcommitView
+}
+
+// handleOvercommitKey handles a key press while the report is shown
+func handleOvercommitKey(ev termbox.Event) {
+	if ev.Key == termbox.KeyEsc || ev.Ch == 'q' || keyMap[keyName(ev)] == CommandOvercommit {
+		overcommitView = false
+	}
+}
+
+// drawOvercommitReport draws the ranked node overcommit report.
+func drawOvercommitReport() {
+	outputWord("node overcommit: limits, requests and usage as a percentage of allocatable, most likely to OOM first", 0, 0, headerColor)
+
+	report := overcommitReport()
+	nameLength := len("NODE")
+	for _, r := range report {
+		name := r.node.Name
+		if len(kubeMetrics) > 1 {
+			name = r.cluster + "/" + name
+		}
+		if len(name) > nameLength {
+			nameLength = len(name)
+		}
+	}
+
+	format := fmt.Sprintf("%%-%ds %%9s %%9s %%9s %%9s %%9s %%9s %%9s  %%s", nameLength)
+	outputWord(fmt.Sprintf(format, "NODE", "MEM LIM", "MEM REQ", "MEM USE", "CPU LIM", "CPU REQ", "CPU USE", "PODS", "CONDITIONS"), 0, 1, headingColor)
+	if len(report) == 0 {
+		outputWord("no nodes, listing nodes needs cluster wide permissions", 0, 2, normalColor)
+	}
+	percent := func(p float64) string {
+		return fmt.Sprintf("%.0f%%", p)
+	}
+	for i, r := range report {
+		y := i + 2
+		if y >= termHeight-2 {
+			break
+		}
+		name := r.node.Name
+		if len(kubeMetrics) > 1 {
+			name = r.cluster + "/" + name
+		}
+		line := fmt.Sprintf(format,
+			name,
+			percent(r.memLimits), percent(r.memRequests), percent(r.memUsage),
+			percent(r.cpuLimits), percent(r.cpuRequests), percent(r.cpuUsage),
+			fmt.Sprintf("%d/%d", r.node.PodCount, r.node.PodCapacity),
+			strings.Join(r.node.Conditions, ", "),
+		)
+		// Memory limits over allocatable means the node can OOM before
+		// every container reaches its limit.
+		color := normalColor
+		if r.memLimits > 100 || len(r.node.Conditions) > 0 {
+			color = warningColor
+		}
+		outputWord(line, 0, y, color)
+	}
+
+	outputWord("(ESC) Close", 0, termHeight-2, footerColor)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const (
+	defaultPrometheusCPUQuery = `sum by (namespace, pod, container) (rate(container_cpu_usage_seconds_total{container!="",container!="POD"}[1m]))`
+	defaultPrometheusMEMQuery = `sum by (namespace, pod, container) (container_memory_working_set_bytes{container!="",container!="POD"})`
+
+	defaultPrometheusThrottleQuery = `sum by (namespace, pod, container) (rate(container_cpu_cfs_throttled_periods_total{container!="",container!="POD"}[5m])) / sum by (namespace, pod, container) (rate(container_cpu_cfs_periods_total{container!="",container!="POD"}[5m]))`
+)
+
+// prometheusBackend fetches the usage from the Prometheus HTTP API. The
+// queries must return an instant vector with namespace, pod and
+// container labels; CPU in cores, memory in bytes and throttling as the
+// fraction of CFS periods the container was throttled in.
+type prometheusBackend struct {
+	url           string
+	cpuQuery      string
+	memQuery      string
+	throttleQuery string
+	client        *http.Client
+}
+
+func newPrometheusBackend(config BackendConfig) (*prometheusBackend, error) {
+	if config.PrometheusURL == "" {
+		return nil, errors.New("a prometheus url is required for the prometheus backend")
+	}
+	p := &prometheusBackend{
+		url:           strings.TrimSuffix(config.PrometheusURL, "/"),
+		cpuQuery:      config.PrometheusCPUQuery,
+		memQuery:      config.PrometheusMEMQuery,
+		throttleQuery: config.PrometheusThrottleQuery,
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.cpuQuery == "" {
+		p.cpuQuery = defaultPrometheusCPUQuery
+	}
+	if p.memQuery == "" {
+		p.memQuery = defaultPrometheusMEMQuery
+	}
+	if p.throttleQuery == "" {
+		p.throttleQuery = defaultPrometheusThrottleQuery
+	}
+	return p, nil
+}
+
+// prometheusResponse is the response from /api/v1/query for an instant
+// vector.
+type prometheusResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string `json:"resultType"`
+		Result     []struct {
+			Metric map[string]string `json:"metric"`
+			// Value is the [<unix time>, "<value>"] pair
+			Value [2]interface{} `json:"value"`
+		} `json:"result"`
+	} `json:"data"`
+}
+
+// prometheusSample is a single result from a query
+type prometheusSample struct {
+	namespace string
+	pod       string
+	container string
+	timestamp time.Time
+	value     float64
+}
+
+func (p *prometheusBackend) query(query string) ([]prometheusSample, error) {
+	resp, err := p.client.Get(p.url + "/api/v1/query?" + url.Values{"query": {query}}.Encode())
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to query prometheus")
+	}
+	defer resp.Body.Close()
+
+	var result prometheusResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "unable to decode prometheus response, status %s", resp.Status)
+	}
+	if result.Status != "success" {
+		return nil, errors.Errorf("prometheus query failed: %s: %s", result.ErrorType, result.Error)
+	}
+	if result.Data.ResultType != "vector" {
+		return nil, errors.Errorf("prometheus query returned a %s, expected a vector", result.Data.ResultType)
+	}
+
+	samples := make([]prometheusSample, 0, len(result.Data.Result))
+	for _, r := range result.Data.Result {
+		ts, ok := r.Value[0].(float64)
+		if !ok {
+			return nil, errors.Errorf("invalid prometheus sample time %v", r.Value[0])
+		}
+		s, ok := r.Value[1].(string)
+		if !ok {
+			return nil, errors.Errorf("invalid prometheus sample value %v", r.Value[1])
+		}
+		value, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid prometheus sample value")
+		}
+		// Ratios are NaN when there is nothing to divide by, ie: the
+		// throttle query for a container that hasn't run.
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		samples = append(samples, prometheusSample{
+			namespace: r.Metric["namespace"],
+			pod:       r.Metric["pod"],
+			container: r.Metric["container"],
+			timestamp: time.Unix(0, int64(ts*float64(time.Second))),
+			value:     value,
+		})
+	}
+	return samples, nil
+}
+
+func (p *prometheusBackend) FetchUsage(namespace string) ([]ContainerUsage, error) {
+	cpuSamples, err := p.query(p.cpuQuery)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get cpu usage")
+	}
+	memSamples, err := p.query(p.memQuery)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get memory usage")
+	}
+
+	// Merge the cpu and memory usage of each container
+	usage := []ContainerUsage{}
+	index := map[string]int{}
+	add := func(s prometheusSample, name corev1.ResourceName, q *resource.Quantity) {
+		if namespace != "" && s.namespace != namespace {
+			return
+		}
+		key := s.namespace + "/" + s.pod + "/" + s.container
+		i, ok := index[key]
+		if !ok {
+			i = len(usage)
+			index[key] = i
+			usage = append(usage, ContainerUsage{
+				Namespace: s.namespace,
+				Pod:       s.pod,
+				Container: s.container,
+				Timestamp: s.timestamp,
+				Usage: corev1.ResourceList{
+					corev1.ResourceCPU:    *resource.NewMilliQuantity(0, resource.DecimalSI),
+					corev1.ResourceMemory: *resource.NewQuantity(0, resource.BinarySI),
+				},
+			})
+		}
+		usage[i].Usage[name] = *q
+	}
+	for _, s := range cpuSamples {
+		add(s, corev1.ResourceCPU, resource.NewMilliQuantity(int64(s.value*1000), resource.DecimalSI))
+	}
+	for _, s := range memSamples {
+		add(s, corev1.ResourceMemory, resource.NewQuantity(int64(s.value), resource.BinarySI))
+	}
+
+	// Not every cluster exports the CFS metrics, so throttling is
+	// optional.
+	throttleSamples, err := p.query(p.throttleQuery)
+	if err != nil {
+		return usage, nil
+	}
+	for _, s := range throttleSamples {
+		if i, ok := index[s.namespace+"/"+s.pod+"/"+s.container]; ok {
+			throttled := s.value * 100
+			usage[i].Throttled = &throttled
+		}
+	}
+	return usage, nil
+}
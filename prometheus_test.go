@@ -0,0 +1,217 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakePrometheus serves canned responses for each query, keyed by the
+// query string.
+func fakePrometheus(t *testing.T, responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/query" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		resp, ok := responses[r.URL.Query().Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			resp = `{"status":"error","errorType":"bad_data","error":"unknown query"}`
+		}
+		w.Write([]byte(resp))
+	}))
+}
+
+func newTestPrometheusBackend(t *testing.T, url string) *prometheusBackend {
+	p, err := newPrometheusBackend(BackendConfig{
+		PrometheusURL:           url,
+		PrometheusCPUQuery:      "cpu",
+		PrometheusMEMQuery:      "mem",
+		PrometheusThrottleQuery: "throttle",
+	})
+	if err != nil {
+		t.Fatalf("unable to create backend: %s", err)
+	}
+	return p
+}
+
+const (
+	cpuResponse = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"namespace":"default","pod":"web-1","container":"app"},"value":[1500000000.5,"0.25"]},
+		{"metric":{"namespace":"kube-system","pod":"dns-1","container":"dns"},"value":[1500000000.5,"0.01"]}
+	]}}`
+	memResponse = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"namespace":"default","pod":"web-1","container":"app"},"value":[1500000000.5,"134217728"]},
+		{"metric":{"namespace":"default","pod":"web-1","container":"sidecar"},"value":[1500000000.5,"1048576"]}
+	]}}`
+	throttleResponse = `{"status":"success","data":{"resultType":"vector","result":[
+		{"metric":{"namespace":"default","pod":"web-1","container":"app"},"value":[1500000000.5,"0.5"]}
+	]}}`
+)
+
+func TestPrometheusFetchUsage(t *testing.T) {
+	server := fakePrometheus(t, map[string]string{
+		"cpu":      cpuResponse,
+		"mem":      memResponse,
+		"throttle": throttleResponse,
+	})
+	defer server.Close()
+
+	usage, err := newTestPrometheusBackend(t, server.URL).FetchUsage("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(usage) != 3 {
+		t.Fatalf("expected 3 containers, got %d", len(usage))
+	}
+
+	byID := map[string]ContainerUsage{}
+	for _, u := range usage {
+		byID[u.Namespace+"/"+u.Pod+"/"+u.Container] = u
+	}
+	app, ok := byID["default/web-1/app"]
+	if !ok {
+		t.Fatalf("missing default/web-1/app in %v", byID)
+	}
+	if cpu := app.Usage.Cpu().MilliValue(); cpu != 250 {
+		t.Errorf("expected app cpu 250m, got %dm", cpu)
+	}
+	if mem := app.Usage.Memory().Value(); mem != 134217728 {
+		t.Errorf("expected app memory 134217728, got %d", mem)
+	}
+	if app.Throttled == nil || *app.Throttled != 50 {
+		t.Errorf("expected app to be 50%% throttled, got %v", app.Throttled)
+	}
+	if app.Timestamp.Unix() != 1500000000 {
+		t.Errorf("expected app timestamp 1500000000, got %d", app.Timestamp.Unix())
+	}
+
+	// Containers missing from one of the queries have zero usage for it
+	sidecar := byID["default/web-1/sidecar"]
+	if cpu := sidecar.Usage.Cpu().MilliValue(); cpu != 0 {
+		t.Errorf("expected sidecar cpu 0, got %dm", cpu)
+	}
+	dns := byID["kube-system/dns-1/dns"]
+	if mem := dns.Usage.Memory().Value(); mem != 0 {
+		t.Errorf("expected dns memory 0, got %d", mem)
+	}
+	if dns.Throttled != nil {
+		t.Errorf("expected dns to have no throttling, got %v", *dns.Throttled)
+	}
+}
+
+func TestPrometheusFetchUsageNamespace(t *testing.T) {
+	server := fakePrometheus(t, map[string]string{
+		"cpu":      cpuResponse,
+		"mem":      memResponse,
+		"throttle": throttleResponse,
+	})
+	defer server.Close()
+
+	usage, err := newTestPrometheusBackend(t, server.URL).FetchUsage("kube-system")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(usage) != 1 || usage[0].Pod != "dns-1" {
+		t.Fatalf("expected only kube-system/dns-1, got %v", usage)
+	}
+}
+
+func TestPrometheusFetchUsageSkipsNaN(t *testing.T) {
+	server := fakePrometheus(t, map[string]string{
+		"cpu": cpuResponse,
+		"mem": memResponse,
+		"throttle": `{"status":"success","data":{"resultType":"vector","result":[
+			{"metric":{"namespace":"default","pod":"web-1","container":"app"},"value":[1500000000.5,"NaN"]},
+			{"metric":{"namespace":"kube-system","pod":"dns-1","container":"dns"},"value":[1500000000.5,"+Inf"]}
+		]}}`,
+	})
+	defer server.Close()
+
+	usage, err := newTestPrometheusBackend(t, server.URL).FetchUsage("")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	for _, u := range usage {
+		if u.Throttled != nil {
+			t.Errorf("expected %s/%s to have no throttling, got %v", u.Pod, u.Container, *u.Throttled)
+		}
+	}
+}
+
+func TestPrometheusFetchUsageWithoutThrottling(t *testing.T) {
+	server := fakePrometheus(t, map[string]string{
+		"cpu": cpuResponse,
+		"mem": memResponse,
+	})
+	defer server.Close()
+
+	usage, err := newTestPrometheusBackend(t, server.URL).FetchUsage("")
+	if err != nil {
+		t.Fatalf("throttling should be optional, got error: %s", err)
+	}
+	if len(usage) != 3 {
+		t.Fatalf("expected 3 containers, got %d", len(usage))
+	}
+}
+
+func TestPrometheusFetchUsageErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses map[string]string
+		err       string
+	}{
+		{
+			name:      "query error",
+			responses: map[string]string{"mem": memResponse},
+			err:       "unable to get cpu usage: prometheus query failed: bad_data: unknown query",
+		},
+		{
+			name: "not a vector",
+			responses: map[string]string{
+				"cpu": `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+				"mem": memResponse,
+			},
+			err: "returned a matrix, expected a vector",
+		},
+		{
+			name: "invalid json",
+			responses: map[string]string{
+				"cpu": cpuResponse,
+				"mem": `not json`,
+			},
+			err: "unable to get memory usage: unable to decode prometheus response",
+		},
+		{
+			name: "invalid value",
+			responses: map[string]string{
+				"cpu": `{"status":"success","data":{"resultType":"vector","result":[
+					{"metric":{"namespace":"default","pod":"web-1","container":"app"},"value":[1500000000.5,"lots"]}
+				]}}`,
+				"mem": memResponse,
+			},
+			err: "invalid prometheus sample value",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := fakePrometheus(t, test.responses)
+			defer server.Close()
+
+			_, err := newTestPrometheusBackend(t, server.URL).FetchUsage("")
+			if err == nil {
+				t.Fatalf("expected an error")
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error containing %q, got %q", test.err, err)
+			}
+		})
+	}
+}
+
+func TestNewPrometheusBackendRequiresURL(t *testing.T) {
+	if _, err := newPrometheusBackend(BackendConfig{}); err == nil {
+		t.Errorf("expected an error without a prometheus url")
+	}
+}
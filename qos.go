@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+var (
+	// qosFilter and priorityFilter only show containers with the QoS
+	// class or priority class, an empty filter shows everything.
+	qosFilter      string
+	priorityFilter string
+
+	// bestEffortMemThreshold highlights BestEffort containers using at
+	// least this much memory, they are the first to be evicted.
+	bestEffortMemThreshold = resource.MustParse("512Mi")
+
+	qosClasses = []string{
+		string(corev1.PodQOSGuaranteed),
+		string(corev1.PodQOSBurstable),
+		string(corev1.PodQOSBestEffort),
+	}
+)
+
+// qosRank orders the QoS classes by eviction order, BestEffort pods are
+// evicted first.
+func qosRank(qos string) int {
+	switch corev1.PodQOSClass(qos) {
+	case corev1.PodQOSBestEffort:
+		return 0
+	case corev1.PodQOSBurstable:
+		return 1
+	case corev1.PodQOSGuaranteed:
+		return 2
+	}
+	return -1
+}
+
+// formatPriority formats the priority class and priority of a pod
+func formatPriority(p PodMetrics) string {
+	if p.PriorityClass == "" {
+		return fmt.Sprintf("%d", p.Priority)
+	}
+	return fmt.Sprintf("%s (%d)", p.PriorityClass, p.Priority)
+}
+
+// isBestEffortHog returns whether the container is BestEffort and using
+// a lot of memory.
+func isBestEffortHog(p PodMetrics) bool {
+	return p.QOSClass == string(corev1.PodQOSBestEffort) && p.Usage.Memory().Cmp(bestEffortMemThreshold) >= 0
+}
+
+// nextFilter returns the filter after current in options, cycling back
+// to no filter after the last option.
+func nextFilter(current string, options []string) string {
+	for i, o := range options {
+		if o == current {
+			if i+1 < len(options) {
+				return options[i+1]
+			}
+			return ""
+		}
+	}
+	if len(options) == 0 {
+		return ""
+	}
+	return options[0]
+}
+
+func cycleQOSFilter() {
+	qosFilter = nextFilter(qosFilter, qosClasses)
+}
+
+// cyclePriorityFilter cycles through the priority classes of the pods
+// currently being shown.
+func cyclePriorityFilter() {
+	classes := map[string]bool{}
+	for _, pm := range kubeMetrics.GetMetrics() {
+		if pm.PriorityClass != "" {
+			classes[pm.PriorityClass] = true
+		}
+	}
+	options := make([]string, 0, len(classes))
+	for class := range classes {
+		options = append(options, class)
+	}
+	sort.Strings(options)
+	priorityFilter = nextFilter(priorityFilter, options)
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// quotaView is the namespace quota view currently open, nil when closed
+var quotaView *QuotaView
+
+// NamespaceQuota is a namespace's ResourceQuotas and LimitRanges along
+// with the totals of its containers from the metrics.
+type NamespaceQuota struct {
+	Cluster     string
+	Namespace   string
+	Quotas      []corev1.ResourceQuota
+	LimitRanges []corev1.LimitRange
+
+	Containers int
+	// Usage, Requests and Limits are the sums over the namespace's
+	// containers
+	Usage    corev1.ResourceList
+	Requests corev1.ResourceList
+	Limits   corev1.ResourceList
+}
+
+// FetchQuotas returns the ResourceQuotas and LimitRanges of every
+// namespace with containers, quotas or limit ranges.
+func (k *KubeMetrics) FetchQuotas() ([]NamespaceQuota, error) {
+	quotas, err := k.kubeClient.CoreV1().ResourceQuotas(k.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get resource quotas")
+	}
+	limitRanges, err := k.kubeClient.CoreV1().LimitRanges(k.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get limit ranges")
+	}
+
+	namespaces := map[string]*NamespaceQuota{}
+	get := func(namespace string) *NamespaceQuota {
+		nq, ok := namespaces[namespace]
+		if !ok {
+			nq = &NamespaceQuota{
+				Cluster:   k.context,
+				Namespace: namespace,
+				Usage:     corev1.ResourceList{},
+				Requests:  corev1.ResourceList{},
+				Limits:    corev1.ResourceList{},
+			}
+			namespaces[namespace] = nq
+		}
+		return nq
+	}
+	for _, q := range quotas.Items {
+		nq := get(q.Namespace)
+		nq.Quotas = append(nq.Quotas, q)
+	}
+	for _, lr := range limitRanges.Items {
+		nq := get(lr.Namespace)
+		nq.LimitRanges = append(nq.LimitRanges, lr)
+	}
+	for _, pm := range k.GetMetrics() {
+		nq := get(pm.Namespace)
+		nq.Containers++
+		addResources(nq.Usage, pm.Usage)
+		addResources(nq.Requests, pm.ResourceRequests)
+		addResources(nq.Limits, pm.ResourceLimits)
+	}
+
+	result := make([]NamespaceQuota, 0, len(namespaces))
+	for _, nq := range namespaces {
+		result = append(result, *nq)
+	}
+	return result, nil
+}
+
+// QuotaView shows the quotas and limit ranges of each namespace over the
+// whole screen.
+type QuotaView struct {
+	mu         sync.Mutex
+	namespaces []NamespaceQuota
+	errs       []string
+	loaded     bool
+	offset     int
+}
+
+func toggleQuotaView() {
+	updateLock.Lock()
+	defer updateLock.Unlock()
+
+	if quotaView != nil {
+		quotaView = nil
+		return
+	}
+	quotaView = &QuotaView{}
+	view := quotaView
+	go func() {
+		view.refresh()
+		requestRedraw()
+	}()
+}
+
+// refreshQuotas refetches the quotas for the open quota view, if any.
+func refreshQuotas() {
+	updateLock.Lock()
+	view := quotaView
+	updateLock.Unlock()
+
+	if view != nil {
+		view.refresh()
+	}
+}
+
+func (q *QuotaView) refresh() {
+	namespaces := []NamespaceQuota{}
+	errs := []string{}
+	for _, k := range kubeMetrics {
+		nqs, err := k.FetchQuotas()
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", k.context, err))
+			continue
+		}
+		namespaces = append(namespaces, nqs...)
+	}
+	// Namespaces with quotas first, as they are the ones that can be
+	// exhausted.
+	sort.Slice(namespaces, func(i, j int) bool {
+		ni, nj := namespaces[i], namespaces[j]
+		if (len(ni.Quotas) > 0) != (len(nj.Quotas) > 0) {
+			return len(ni.Quotas) > 0
+		}
+		if ni.Cluster != nj.Cluster {
+			return ni.Cluster < nj.Cluster
+		}
+		return ni.Namespace < nj.Namespace
+	})
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.namespaces = namespaces
+	q.errs = errs
+	q.loaded = true
+}
+
+// handleQuotaKey handles a key press while the quota view is shown
+func handleQuotaKey(ev termbox.Event) {
+	q := quotaView
+	switch {
+	case ev.Key == termbox.KeyEsc || ev.Ch == 'q' || keyMap[keyName(ev)] == CommandQuotas:
+		toggleQuotaView()
+	case ev.Key == termbox.KeyArrowUp:
+		q.scroll(-1)
+	case ev.Key == termbox.KeyArrowDown:
+		q.scroll(1)
+	case ev.Key == termbox.KeyPgup:
+		q.scroll(-(termHeight - 3))
+	case ev.Key == termbox.KeyPgdn:
+		q.scroll(termHeight - 3)
+	}
+}
+
+func (q *QuotaView) scroll(n int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.offset += n
+	if q.offset < 0 {
+		q.offset = 0
+	}
+}
+
+// quotaLine is a line of the quota view
+type quotaLine struct {
+	text  string
+	color TermColor
+}
+
+// lines returns the lines of the quota view, with quotas that are at
+// least 90% used highlighted.
+func (nq NamespaceQuota) lines() []quotaLine {
+	name := "namespace " + nq.Namespace
+	if len(kubeMetrics) > 1 {
+		name = nq.Cluster + " " + name
+	}
+	lines := []quotaLine{{
+		text: fmt.Sprintf(
+			"%s | %d containers | usage cpu=%s mem=%s | requests cpu=%s mem=%s | limits cpu=%s mem=%s",
+			name, nq.Containers,
+			formatQuantityCPU(nq.Usage), formatQuantityMEM(nq.Usage),
+			formatQuantityCPU(nq.Requests), formatQuantityMEM(nq.Requests),
+			formatQuantityCPU(nq.Limits), formatQuantityMEM(nq.Limits),
+		),
+		color: headingColor,
+	}}
+
+	for _, quota := range nq.Quotas {
+		lines = append(lines, quotaLine{text: "  quota " + quota.Name, color: normalColor})
+		names := make([]string, 0, len(quota.Status.Hard))
+		for name := range quota.Status.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			hard := quota.Status.Hard[corev1.ResourceName(name)]
+			used := quota.Status.Used[corev1.ResourceName(name)]
+			percent, ok := percentOf(&used, &hard)
+			text := fmt.Sprintf("    %-28s %10s / %-10s %5s", name, used.String(), hard.String(), formatPercent(percent, ok))
+			if actual := nq.actualUsage(corev1.ResourceName(name)); actual != "" {
+				text += "  actual usage " + actual
+			}
+			color := normalColor
+			if ok && percent >= 90 {
+				color = warningColor
+			}
+			lines = append(lines, quotaLine{text: text, color: color})
+		}
+	}
+
+	for _, lr := range nq.LimitRanges {
+		lines = append(lines, quotaLine{text: "  limitrange " + lr.Name, color: normalColor})
+		for _, item := range lr.Spec.Limits {
+			parts := []string{}
+			for _, l := range []struct {
+				name string
+				rl   corev1.ResourceList
+			}{
+				{"default", item.Default},
+				{"default request", item.DefaultRequest},
+				{"min", item.Min},
+				{"max", item.Max},
+			} {
+				if len(l.rl) > 0 {
+					parts = append(parts, l.name+" "+formatResourceList(l.rl))
+				}
+			}
+			lines = append(lines, quotaLine{
+				text:  fmt.Sprintf("    %-10s %s", item.Type, strings.Join(parts, " | ")),
+				color: normalColor,
+			})
+		}
+	}
+	return lines
+}
+
+// actualUsage returns the metrics based usage of the namespace for a
+// quota's cpu or memory resource, so it can be compared with the
+// requests and limits counted against the quota.
+func (nq NamespaceQuota) actualUsage(name corev1.ResourceName) string {
+	switch name {
+	case corev1.ResourceCPU, corev1.ResourceRequestsCPU, corev1.ResourceLimitsCPU:
+		return formatQuantityCPU(nq.Usage)
+	case corev1.ResourceMemory, corev1.ResourceRequestsMemory, corev1.ResourceLimitsMemory:
+		return formatQuantityMEM(nq.Usage)
+	}
+	return ""
+}
+
+// formatResourceList formats the resources ordered by name, ie:
+// cpu=100m memory=128Mi.
+func formatResourceList(rl corev1.ResourceList) string {
+	parts := make([]string, 0, len(rl))
+	for name, q := range rl {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, q.String()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// drawQuotaView draws the quotas and limit ranges of every namespace.
+func drawQuotaView() {
+	q := quotaView
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	outputWord("namespace quotas: quota hard vs used alongside the actual usage of the namespace's containers", 0, 0, headerColor)
+
+	lines := []quotaLine{}
+	for _, e := range q.errs {
+		lines = append(lines, quotaLine{text: e, color: warningColor})
+	}
+	if !q.loaded {
+		lines = append(lines, quotaLine{text: "loading...", color: normalColor})
+	}
+	for _, nq := range q.namespaces {
+		lines = append(lines, nq.lines()...)
+	}
+
+	height := termHeight - 3
+	if max := len(lines) - height; q.offset > max {
+		q.offset = max
+	}
+	if q.offset < 0 {
+		q.offset = 0
+	}
+	for i, line := range lines[q.offset:] {
+		if i >= height {
+			break
+		}
+		outputWord(line.text, 0, i+1, line.color)
+	}
+
+	outputWord("(ESC) Close (UP/DOWN/PGUP/PGDN) Scroll", 0, termHeight-2, footerColor)
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// minRecommendationSamples is the number of samples needed before
+	// making a recommendation.
+	minRecommendationSamples = 10
+
+	// recommendationHeadroom is added on top of the observed usage
+	recommendationHeadroom = 0.15
+)
+
+// recommendationsDir is where the recommendations are exported to
+var recommendationsDir = "ktop-recommendations"
+
+// Recommendation is the suggested requests and limits for a container,
+// CPU is in millicores and memory in bytes.
+type Recommendation struct {
+	CPURequest int64
+	CPULimit   int64
+	MEMRequest int64
+	MEMLimit   int64
+}
+
+func (r Recommendation) String() string {
+	return fmt.Sprintf(
+		"recommended requests: cpu=%s mem=%s -- limits: cpu=%s mem=%s",
+		formatMilliCPU(r.CPURequest), formatMEM(r.MEMRequest),
+		formatMilliCPU(r.CPULimit), formatMEM(r.MEMLimit),
+	)
+}
+
+// recommend calculates the recommended requests and limits from the
+// usage samples; requests are the p90 usage and the CPU limit the p99
+// usage, the memory limit is the max usage as exceeding it is fatal. All
+// have headroom added. False is returned if there aren't enough samples.
+func recommend(samples []Sample) (Recommendation, bool) {
+	if len(samples) < minRecommendationSamples {
+		return Recommendation{}, false
+	}
+	cpu := make([]int64, len(samples))
+	mem := make([]int64, len(samples))
+	for i, s := range samples {
+		cpu[i] = s.CPU
+		mem[i] = s.MEM
+	}
+	withHeadroom := func(v int64) int64 {
+		return int64(float64(v) * (1 + recommendationHeadroom))
+	}
+	return Recommendation{
+		CPURequest: withHeadroom(percentile(cpu, 0.90)),
+		CPULimit:   withHeadroom(percentile(cpu, 0.99)),
+		MEMRequest: withHeadroom(percentile(mem, 0.90)),
+		MEMLimit:   withHeadroom(percentile(mem, 1)),
+	}, true
+}
+
+// percentile returns the p percentile, 0 < p <= 1, of the values using
+// the nearest rank method. The values are sorted in place.
+func percentile(values []int64, p float64) int64 {
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	rank := int(p*float64(len(values))+0.5) - 1
+	if rank < 0 {
+		rank = 0
+	} else if rank >= len(values) {
+		rank = len(values) - 1
+	}
+	return values[rank]
+}
+
+// recommendableKinds are the workloads that can be patched with the
+// recommendations, all are in apps/v1. Jobs are left out as their pod
+// template can't be changed.
+var recommendableKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+	"ReplicaSet":  true,
+}
+
+// workload identifies a workload in a cluster
+type workload struct {
+	cluster   string
+	namespace string
+	kind      string
+	name      string
+}
+
+// workloadContainer identifies a container across all pods of a workload
+type workloadContainer struct {
+	workload
+	init      bool
+	container string
+}
+
+// exportRecommendations writes the recommendations for every workload as
+// a YAML patch per workload to the recommendations directory. Samples
+// from all the pods of a workload are combined for each of its
+// containers.
+func exportRecommendations() {
+	statusString = "exporting recommendations..."
+	go func() {
+		message := fmt.Sprintf("recommendations exported to %s", recommendationsDir)
+		if err := writeRecommendations(recommendationsDir); err != nil {
+			message = err.Error()
+		}
+		updateLock.Lock()
+		statusString = message
+		updateLock.Unlock()
+		requestRedraw()
+	}()
+}
+
+func writeRecommendations(dir string) error {
+	samples := map[workloadContainer][]Sample{}
+	for _, pm := range kubeMetrics.GetMetrics() {
+		if !recommendableKinds[pm.WorkloadKind] {
+			continue
+		}
+		key := workloadContainer{
+			workload: workload{
+				cluster:   pm.Cluster,
+				namespace: pm.Namespace,
+				kind:      pm.WorkloadKind,
+				name:      pm.WorkloadName,
+			},
+			init:      pm.ContainerType == ContainerTypeInit,
+			container: pm.Container,
+		}
+		samples[key] = append(samples[key], history.Samples(pm.UniqueID())...)
+	}
+
+	// Group the containers by workload so there is one patch per workload
+	recommendations := map[workload]map[workloadContainer]Recommendation{}
+	for key, s := range samples {
+		r, ok := recommend(s)
+		if !ok {
+			continue
+		}
+		if recommendations[key.workload] == nil {
+			recommendations[key.workload] = map[workloadContainer]Recommendation{}
+		}
+		recommendations[key.workload][key] = r
+	}
+	if len(recommendations) == 0 {
+		return errors.New("not enough history to make any recommendations yet")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "unable to create recommendations directory")
+	}
+	for w, containers := range recommendations {
+		path := filepath.Join(dir, w.fileName())
+		if err := ioutil.WriteFile(path, recommendationPatch(w, path, containers), 0644); err != nil {
+			return errors.Wrapf(err, "unable to write recommendations")
+		}
+	}
+	return nil
+}
+
+// fileName is the name of the workload's patch file, ie:
+// prod_default_deployment_web.yaml.
+func (w workload) fileName() string {
+	clean := func(s string) string {
+		return strings.Map(func(r rune) rune {
+			if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+				return r
+			}
+			return '-'
+		}, s)
+	}
+	parts := []string{clean(w.cluster), clean(w.namespace), strings.ToLower(w.kind), clean(w.name)}
+	return strings.Join(parts, "_") + ".yaml"
+}
+
+// recommendationPatch is the strategic merge patch setting the
+// recommended resources of the workload's containers, with init
+// containers patched separately from the app containers.
+func recommendationPatch(w workload, path string, containers map[workloadContainer]Recommendation) []byte {
+	keys := make([]workloadContainer, 0, len(containers))
+	for key := range containers {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].init != keys[j].init {
+			return keys[i].init
+		}
+		return keys[i].container < keys[j].container
+	})
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# %s %s/%s in context %s, apply with:\n", strings.ToLower(w.kind), w.namespace, w.name, w.cluster)
+	fmt.Fprintf(&buf, "# kubectl --context %s --namespace %s patch %s %s --patch \"$(cat %s)\"\n", w.cluster, w.namespace, strings.ToLower(w.kind), w.name, path)
+	buf.WriteString("spec:\n  template:\n    spec:\n")
+	section := ""
+	for _, key := range keys {
+		name := "containers"
+		if key.init {
+			name = "initContainers"
+		}
+		if name != section {
+			section = name
+			fmt.Fprintf(&buf, "      %s:\n", section)
+		}
+		r := containers[key]
+		fmt.Fprintf(&buf, "      - name: %s\n", key.container)
+		fmt.Fprintf(&buf, "        resources:\n")
+		fmt.Fprintf(&buf, "          requests:\n            cpu: %s\n            memory: %s\n", formatMilliCPU(r.CPURequest), formatMEM(r.MEMRequest))
+		fmt.Fprintf(&buf, "          limits:\n            cpu: %s\n            memory: %s\n", formatMilliCPU(r.CPULimit), formatMEM(r.MEMLimit))
+	}
+	return buf.Bytes()
+}
@@ -1 +1,176 @@
 package main
+
+import (
+	"sort"
+	"time"
+)
+
+// SortKey is a column to sort by and the direction to sort in.
+type SortKey struct {
+	header *DisplayHeader
+	desc   bool
+}
+
+var (
+	// primarySort is the column the rows are sorted by, ties are broken
+	// with secondarySort and then by name. A nil header is not sorted.
+	primarySort   SortKey
+	secondarySort SortKey
+)
+
+// setSort makes header the primary sort column, the previous primary
+// sort column becomes the secondary sort column.
+func setSort(header *DisplayHeader, desc bool) {
+	if primarySort.header != header {
+		secondarySort = primarySort
+	}
+	primarySort = SortKey{header: header, desc: desc}
+}
+
+// toggleSort sorts by header, or reverses the sort direction if we are
+// already sorting by it. New columns are sorted descending first.
+func toggleSort(header *DisplayHeader) {
+	if primarySort.header == header {
+		reverseSort()
+		return
+	}
+	setSort(header, true)
+}
+
+func reverseSort() {
+	if primarySort.header != nil {
+		primarySort.desc = !primarySort.desc
+	}
+}
+
+// moveSort moves the primary sort column i columns to the left or right
+// of the current primary sort column.
+func moveSort(i int) {
+	headers := visibleHeaders()
+	if len(headers) == 0 {
+		return
+	}
+	index := -1
+	if i < 0 {
+		index = len(headers)
+	}
+	for hi, header := range headers {
+		if header == primarySort.header {
+			index = hi
+			break
+		}
+	}
+	index += i
+	if index < 0 {
+		index = 0
+	} else if index >= len(headers) {
+		index = len(headers) - 1
+	}
+	setSort(headers[index], primarySort.desc)
+}
+
+func sortArrow(desc bool) string {
+	if desc {
+		return " ▼"
+	}
+	return " ▲"
+}
+
+func sortMetrics(podMetrics []PodMetrics) {
+	sort.Slice(podMetrics, func(i, j int) bool {
+		pi := podMetrics[i]
+		pj := podMetrics[j]
+		for _, key := range []SortKey{primarySort, secondarySort} {
+			if key.header == nil {
+				continue
+			}
+			result := key.header.Compare(pi, pj)
+			if result == 0 {
+				continue
+			}
+			if key.desc {
+				return result > 0
+			}
+			return result < 0
+		}
+		return lessByName(pi, pj)
+	})
+}
+
+// lessByName orders by pod, then container, then cluster so that rows
+// have a stable order across multiple clusters.
+func lessByName(pi, pj PodMetrics) bool {
+	if pi.Pod != pj.Pod {
+		return pi.Pod < pj.Pod
+	}
+	if pi.Container != pj.Container {
+		return pi.Container < pj.Container
+	}
+	return pi.Cluster < pj.Cluster
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareSince compares the time since ti and tj, a zero time is treated
+// as the shortest.
+func compareSince(ti, tj time.Time) int {
+	switch {
+	case ti.Equal(tj):
+		return 0
+	case ti.IsZero():
+		return -1
+	case tj.IsZero():
+		return 1
+	case ti.Before(tj):
+		return 1
+	}
+	return -1
+}
+
+// comparePercent compares two percentages, a missing percentage is
+// less than any other percentage.
+func comparePercent(pi, pj func() (float64, bool)) int {
+	a, aok := pi()
+	b, bok := pj()
+	switch {
+	case !aok && !bok:
+		return 0
+	case !aok:
+		return -1
+	case !bok:
+		return 1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cpuDelta returns the change in CPU usage in millicores since the
+// snapshot was taken.
+func cpuDelta(p PodMetrics) (int64, bool) {
+	prev, ok := previousPodMetrics[p.UniqueID()]
+	if !ok {
+		return 0, false
+	}
+	return p.Usage.Cpu().MilliValue() - prev.Usage.Cpu().MilliValue(), true
+}
+
+// memDelta returns the change in memory usage in Mi since the snapshot
+// was taken.
+func memDelta(p PodMetrics) (int64, bool) {
+	prev, ok := previousPodMetrics[p.UniqueID()]
+	if !ok {
+		return 0, false
+	}
+	return (p.Usage.Memory().Value() - prev.Usage.Memory().Value()) / (1 << 20), true
+}
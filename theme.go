@@ -0,0 +1,164 @@
+package main
+
+import (
+	"os"
+	"sort"
+	"strings"
+
+	termbox "github.com/nsf/termbox-go"
+	"github.com/pkg/errors"
+)
+
+// Theme is the set of colours used to draw the screen.
+type Theme struct {
+	normal         TermColor
+	heading        TermColor
+	highlighted    TermColor
+	changeIncrease TermColor
+	changeDecrease TermColor
+	warning        TermColor
+	header         TermColor
+	footer         TermColor
+}
+
+const defaultTheme = "dark"
+
+var (
+	themes = map[string]Theme{
+		"dark": {
+			normal:         TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite},
+			heading:        TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite | termbox.AttrBold},
+			highlighted:    TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+			changeIncrease: TermColor{bg: termbox.ColorGreen, fg: termbox.ColorWhite | termbox.AttrBold},
+			changeDecrease: TermColor{bg: termbox.ColorRed, fg: termbox.ColorWhite | termbox.AttrBold},
+			warning:        TermColor{bg: termbox.ColorBlack, fg: termbox.ColorRed | termbox.AttrBold},
+			header:         TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+			footer:         TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+		},
+		"light": {
+			normal:         TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+			heading:        TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack | termbox.AttrBold},
+			highlighted:    TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite},
+			changeIncrease: TermColor{bg: termbox.ColorGreen, fg: termbox.ColorBlack | termbox.AttrBold},
+			changeDecrease: TermColor{bg: termbox.ColorRed, fg: termbox.ColorWhite | termbox.AttrBold},
+			warning:        TermColor{bg: termbox.ColorWhite, fg: termbox.ColorRed | termbox.AttrBold},
+			header:         TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite},
+			footer:         TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite},
+		},
+		// Blue and yellow remain distinguishable for the common forms
+		// of colour blindness, unlike green and red.
+		"colourblind": {
+			normal:         TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite},
+			heading:        TermColor{bg: termbox.ColorBlack, fg: termbox.ColorWhite | termbox.AttrBold},
+			highlighted:    TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+			changeIncrease: TermColor{bg: termbox.ColorBlue, fg: termbox.ColorWhite | termbox.AttrBold},
+			changeDecrease: TermColor{bg: termbox.ColorYellow, fg: termbox.ColorBlack | termbox.AttrBold},
+			warning:        TermColor{bg: termbox.ColorBlack, fg: termbox.ColorYellow | termbox.AttrBold},
+			header:         TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+			footer:         TermColor{bg: termbox.ColorWhite, fg: termbox.ColorBlack},
+		},
+		// Monochrome uses the terminal's default colours and relies on
+		// attributes and the ^ / v change symbols only.
+		"monochrome": {
+			normal:         TermColor{bg: termbox.ColorDefault, fg: termbox.ColorDefault},
+			heading:        TermColor{bg: termbox.ColorDefault, fg: termbox.AttrBold},
+			highlighted:    TermColor{bg: termbox.ColorDefault, fg: termbox.AttrReverse},
+			changeIncrease: TermColor{bg: termbox.ColorDefault, fg: termbox.AttrBold},
+			changeDecrease: TermColor{bg: termbox.ColorDefault, fg: termbox.AttrUnderline},
+			warning:        TermColor{bg: termbox.ColorDefault, fg: termbox.AttrBold | termbox.AttrUnderline},
+			header:         TermColor{bg: termbox.ColorDefault, fg: termbox.AttrReverse},
+			footer:         TermColor{bg: termbox.ColorDefault, fg: termbox.AttrReverse},
+		},
+	}
+
+	// themes256 are richer variants of themes used when the terminal
+	// supports 256 colours.
+	themes256 = map[string]Theme{
+		"dark": {
+			normal:         TermColor{bg: color256(0), fg: color256(252)},
+			heading:        TermColor{bg: color256(0), fg: color256(255) | termbox.AttrBold},
+			highlighted:    TermColor{bg: color256(240), fg: color256(255)},
+			changeIncrease: TermColor{bg: color256(28), fg: color256(255) | termbox.AttrBold},
+			changeDecrease: TermColor{bg: color256(124), fg: color256(255) | termbox.AttrBold},
+			warning:        TermColor{bg: color256(0), fg: color256(203) | termbox.AttrBold},
+			header:         TermColor{bg: color256(250), fg: color256(0)},
+			footer:         TermColor{bg: color256(250), fg: color256(0)},
+		},
+		"light": {
+			normal:         TermColor{bg: color256(255), fg: color256(235)},
+			heading:        TermColor{bg: color256(255), fg: color256(232) | termbox.AttrBold},
+			highlighted:    TermColor{bg: color256(189), fg: color256(232)},
+			changeIncrease: TermColor{bg: color256(151), fg: color256(232) | termbox.AttrBold},
+			changeDecrease: TermColor{bg: color256(217), fg: color256(232) | termbox.AttrBold},
+			warning:        TermColor{bg: color256(255), fg: color256(160) | termbox.AttrBold},
+			header:         TermColor{bg: color256(238), fg: color256(255)},
+			footer:         TermColor{bg: color256(238), fg: color256(255)},
+		},
+		"colourblind": {
+			normal:         TermColor{bg: color256(0), fg: color256(252)},
+			heading:        TermColor{bg: color256(0), fg: color256(255) | termbox.AttrBold},
+			highlighted:    TermColor{bg: color256(240), fg: color256(255)},
+			changeIncrease: TermColor{bg: color256(33), fg: color256(255) | termbox.AttrBold},
+			changeDecrease: TermColor{bg: color256(208), fg: color256(0) | termbox.AttrBold},
+			warning:        TermColor{bg: color256(0), fg: color256(214) | termbox.AttrBold},
+			header:         TermColor{bg: color256(250), fg: color256(0)},
+			footer:         TermColor{bg: color256(250), fg: color256(0)},
+		},
+	}
+)
+
+// color256 returns the termbox attribute for a colour from the 256
+// colour palette; termbox offsets the palette by one.
+func color256(n int) termbox.Attribute {
+	return termbox.Attribute(n + 1)
+}
+
+// themeNames returns the sorted names of the available themes.
+func themeNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// supports256Colors guesses whether the terminal supports 256 colours
+// from $TERM.
+func supports256Colors() bool {
+	return strings.Contains(os.Getenv("TERM"), "256color")
+}
+
+// noColor reports whether NO_COLOR is set, see https://no-color.org.
+func noColor() bool {
+	return os.Getenv("NO_COLOR") != ""
+}
+
+// applyTheme sets the display colours from the named theme and returns
+// the termbox output mode to use. colors is either 8 or 256.
+func applyTheme(name string, colors int) (termbox.OutputMode, error) {
+	theme, ok := themes[name]
+	if !ok {
+		return termbox.OutputNormal, errors.Errorf("unknown theme %q, available themes are: %s", name, strings.Join(themeNames(), ", "))
+	}
+
+	outputMode := termbox.OutputNormal
+	if colors == 256 {
+		if t, ok := themes256[name]; ok {
+			theme = t
+			outputMode = termbox.Output256
+		}
+	} else if colors != 8 {
+		return termbox.OutputNormal, errors.Errorf("unsupported number of colours %d, must be 8 or 256", colors)
+	}
+
+	normalColor = theme.normal
+	headingColor = theme.heading
+	highlightedColor = theme.highlighted
+	changeIncreaseColor = theme.changeIncrease
+	changeDecreaseColor = theme.changeDecrease
+	warningColor = theme.warning
+	headerColor = theme.header
+	footerColor = theme.footer
+	return outputMode, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import "fmt"
+
+const (
+	// throttleRiskHigh and throttleRiskMedium are the average CPU usage,
+	// as a percentage of the CPU limit, at which a container is likely
+	// being throttled. Usage is averaged over the metrics window, so
+	// short bursts up to the limit are throttled well before the average
+	// reaches it.
+	throttleRiskHigh   = 80
+	throttleRiskMedium = 50
+)
+
+// throttlingAvailable is set when the backend provides the actual CFS
+// throttling of the containers.
+var throttlingAvailable bool
+
+// throttleRisk returns the average CPU usage over the samples as a
+// percentage of the CPU limit, limit is in millicores. False is returned
+// if there is no CPU limit or no samples.
+func throttleRisk(samples []Sample, limit int64) (float64, bool) {
+	if limit <= 0 || len(samples) == 0 {
+		return 0, false
+	}
+	var total int64
+	for _, s := range samples {
+		total += s.CPU
+	}
+	return float64(total) / float64(len(samples)) / float64(limit) * 100, true
+}
+
+// updateThrottleRisk sets the container's throttle risk from its history
+// samples.
+func updateThrottleRisk(pm *PodMetrics, samples []Sample) {
+	risk, ok := throttleRisk(samples, pm.ResourceLimits.Cpu().MilliValue())
+	if ok {
+		pm.ThrottleRisk = &risk
+	}
+}
+
+// formatThrottleRisk formats the risk level and the average usage as a
+// percentage of the limit, ie: high 85%.
+func formatThrottleRisk(p PodMetrics) string {
+	if p.ThrottleRisk == nil {
+		return "-"
+	}
+	risk := *p.ThrottleRisk
+	level := "low"
+	switch {
+	case risk >= throttleRiskHigh:
+		level = "high"
+	case risk >= throttleRiskMedium:
+		level = "medium"
+	}
+	return fmt.Sprintf("%s %.0f%%", level, risk)
+}
+
+// optionalPercent returns a percentage for comparePercent
+func optionalPercent(p *float64) func() (float64, bool) {
+	return func() (float64, bool) {
+		if p == nil {
+			return 0, false
+		}
+		return *p, true
+	}
+}
+
+// maxPercent returns the larger of two optional percentages.
+func maxPercent(a, b *float64) *float64 {
+	if a == nil || (b != nil && *b > *a) {
+		return b
+	}
+	return a
+}